@@ -88,6 +88,13 @@ const (
 	// This package transparently handles these types.
 	TypeGNULongName = 'L'
 	TypeGNULongLink = 'K'
+
+	// Types 'A', 'E', 'I' and 'X' are extensions of Solaris tar and star.
+	// This package returns them as they are, along with their data.
+	TypeSolarisACL     = 'A' // ACL of the next file, see ParseSolarisACL and Header.ACL
+	TypeSolarisExtAttr = 'E' // Extended attribute file
+	TypeSolarisInode   = 'I' // Inode metadata only, without the content
+	TypeSolarisXHeader = 'X' // Extended header, see ParseRecords
 )
 
 // Keywords for PAX extended header records.
@@ -108,6 +115,12 @@ const (
 
 	paxSchilyXattr = "SCHILY.xattr."
 
+	// Keywords of star and bsdtar for access control lists and file flags.
+	paxSchilyACLAccess  = "SCHILY.acl.access"
+	paxSchilyACLDefault = "SCHILY.acl.default"
+	paxSchilyACLACE     = "SCHILY.acl.ace"
+	paxSchilyFflags     = "SCHILY.fflags"
+
 	// Keywords for GNU sparse files in a PAX extended header.
 	paxGNUSparse          = "GNU.sparse."
 	paxGNUSparseNumBlocks = "GNU.sparse.numblocks"
@@ -200,6 +213,21 @@ type Header struct {
 	// then it uses the first format (in the order of USTAR, PAX, GNU)
 	// capable of encoding this Header (see Format).
 	Format Format
+
+	// Diagnostics are the deviations from the tar format that Reader.Next
+	// accepted in the headers of this entry, when reading with a Leniency
+	// other than Strict. They are ignored by Writer.WriteHeader.
+	Diagnostics []Diagnostic
+}
+
+// Diagnostic is a deviation from the tar format in a header block.
+type Diagnostic struct {
+	Field   string // Name of the header field, like "chksum" or "size"
+	Message string // What is wrong with it
+}
+
+func (d Diagnostic) String() string {
+	return d.Field + ": " + d.Message
 }
 
 // sparseEntry represents a Length-sized fragment at Offset in the file.
@@ -525,6 +553,83 @@ func (h Header) allowedFormats() (format Format, paxHdrs map[string]string, err
 	return format, paxHdrs, err
 }
 
+// ACL is the access control lists of a file, as star and bsdtar record them
+// in PAX records. Entries are in the text form of their kind, like
+// "user:bin:r-x" or "owner@:rwxp--aARWcCos:-------:allow".
+type ACL struct {
+	Access  []string // POSIX.1e access ACL
+	Default []string // POSIX.1e default ACL of a directory
+	NFSv4   []string // NFSv4 ACL
+}
+
+// ACL returns the access control lists of the file, from the
+// SCHILY.acl.access, SCHILY.acl.default and SCHILY.acl.ace PAX records.
+func (h *Header) ACL() ACL {
+	return ACL{
+		Access:  splitRecordList(h.PAXRecords[paxSchilyACLAccess]),
+		Default: splitRecordList(h.PAXRecords[paxSchilyACLDefault]),
+		NFSv4:   splitRecordList(h.PAXRecords[paxSchilyACLACE]),
+	}
+}
+
+// SetACL sets the PAX records of the access control lists of the file.
+// Empty lists remove their record.
+func (h *Header) SetACL(acl ACL) {
+	h.setRecordList(paxSchilyACLAccess, acl.Access)
+	h.setRecordList(paxSchilyACLDefault, acl.Default)
+	h.setRecordList(paxSchilyACLACE, acl.NFSv4)
+}
+
+// FileFlags returns the file flags of the file, like "uchg" or "nodump", from
+// the SCHILY.fflags PAX record.
+func (h *Header) FileFlags() []string {
+	return splitRecordList(h.PAXRecords[paxSchilyFflags])
+}
+
+// SetFileFlags sets the PAX record of the file flags of the file. No flags
+// remove the record.
+func (h *Header) SetFileFlags(flags []string) {
+	h.setRecordList(paxSchilyFflags, flags)
+}
+
+// VendorRecords returns the PAX records of the namespace vendor, like
+// "LIBARCHIVE" or "SCHILY", by their keyword without the namespace, or nil if
+// there are none.
+func (h *Header) VendorRecords(vendor string) map[string]string {
+	var records map[string]string
+	prefix := vendor + "."
+	for k, v := range h.PAXRecords {
+		if strings.HasPrefix(k, prefix) {
+			if records == nil {
+				records = make(map[string]string)
+			}
+			records[k[len(prefix):]] = v
+		}
+	}
+	return records
+}
+
+// splitRecordList splits the comma separated list of a PAX record.
+func splitRecordList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// setRecordList sets the PAX record key to the comma separated list, or
+// deletes it if the list is empty.
+func (h *Header) setRecordList(key string, list []string) {
+	if len(list) == 0 {
+		delete(h.PAXRecords, key)
+		return
+	}
+	if h.PAXRecords == nil {
+		h.PAXRecords = make(map[string]string)
+	}
+	h.PAXRecords[key] = strings.Join(list, ",")
+}
+
 // FileInfo returns an os.FileInfo for the Header.
 func (h *Header) FileInfo() os.FileInfo {
 	return headerFileInfo{h}
@@ -4,7 +4,10 @@
 
 package tar
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 // Format represents the tar archive format.
 //
@@ -170,16 +173,41 @@ func (b *block) Sparse() sparseArray { return (sparseArray)(b[:]) }
 // It then attempts to guess the specific format based on magic values.
 // If the checksum fails, then FormatUnknown is returned.
 func (b *block) GetFormat() Format {
-	// Verify checksum.
 	var p parser
-	value := p.parseOctal(b.V7().Chksum())
+	return b.getFormat(&p)
+}
+
+// getFormat is GetFormat, accepting the checksums allowed by the leniency of
+// p, and recording the deviations in its diagnostics.
+func (b *block) getFormat(p *parser) Format {
+	// Verify checksum.
+	magic := string(b.USTAR().Magic())
+	cp := parser{leniency: p.leniency}
+	var value int64
+	if field := b.V7().Chksum(); field[0]&0x80 != 0 && p.leniency >= LenientNumeric {
+		value = cp.parseNumeric(field)
+		cp.diagnose("checksum encoded in base-256")
+	} else {
+		value = cp.parseOctal(field)
+	}
 	chksum1, chksum2 := b.ComputeChecksum()
-	if p.err != nil || (value != chksum1 && value != chksum2) {
+	switch {
+	case cp.err == nil && value == chksum1:
+	case cp.err == nil && value == chksum2:
+		cp.diagnose("checksum computed over signed bytes")
+	case p.leniency >= LenientChecksum && (magic == magicUSTAR || magic == magicGNU):
+		if cp.err != nil {
+			cp.diagnose(fmt.Sprintf("invalid checksum, should be %d", chksum1))
+		} else {
+			cp.diagnose(fmt.Sprintf("checksum %d should be %d", value, chksum1))
+		}
+	default:
 		return FormatUnknown
 	}
+	cp.tagDiagnostics(0, "chksum")
+	p.diagnostics = append(p.diagnostics, cp.diagnostics...)
 
 	// Guess the magic values.
-	magic := string(b.USTAR().Magic())
 	version := string(b.USTAR().Version())
 	trailer := string(b.STAR().Trailer())
 	switch {
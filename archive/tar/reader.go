@@ -28,8 +28,41 @@ type Reader struct {
 
 	RawAccounting bool          // Whether to enable the access needed to reassemble the tar from raw bytes. Some performance/memory hit for this.
 	rawBytes      *bytes.Buffer // last raw bits
+
+	// IgnoreZeros skips blocks of zero bytes, rather than taking them as the
+	// end of the archive, like GNU tar --ignore-zeros. This reads on through
+	// archives concatenated together, and Next only returns io.EOF at the end
+	// of the input, which must then end on a block boundary.
+	IgnoreZeros bool
+
+	// Leniency is how far the headers may deviate from the tar format, as
+	// some legacy producers write them, see Header.Diagnostics.
+	Leniency Leniency
 }
 
+// Leniency is a level of leniency of a Reader towards malformed headers.
+// Each level accepts what the ones before do.
+type Leniency int
+
+const (
+	// Strict reads the headers as archive/tar does. This is the default.
+	Strict Leniency = iota
+
+	// Diagnose reads the headers as Strict does, but records the deviations
+	// accepted anyway in Header.Diagnostics, like checksums computed over
+	// signed bytes or numeric fields that are not NUL or space terminated.
+	Diagnose
+
+	// LenientNumeric also accepts numeric fields with bytes other than octal
+	// digits, keeping the value of their leading digits, and checksums
+	// encoded in base-256.
+	LenientNumeric
+
+	// LenientChecksum also accepts headers whose checksum does not match, if
+	// they have the magic of the USTAR or GNU formats.
+	LenientChecksum
+)
+
 type fileReader interface {
 	io.Reader
 	fileState
@@ -83,6 +116,7 @@ func (tr *Reader) Next() (*Header, error) {
 func (tr *Reader) next() (*Header, error) {
 	var paxHdrs map[string]string
 	var gnuLongName, gnuLongLink string
+	var diagnostics []Diagnostic // of the meta headers too
 
 	if tr.RawAccounting {
 		if tr.rawBytes == nil {
@@ -116,6 +150,7 @@ func (tr *Reader) next() (*Header, error) {
 		if err != nil {
 			return nil, err
 		}
+		diagnostics = append(diagnostics, hdr.Diagnostics...)
 		if err := tr.handleRegularFile(hdr); err != nil {
 			return nil, err
 		}
@@ -134,11 +169,12 @@ func (tr *Reader) next() (*Header, error) {
 					return nil, err
 				}
 				return &Header{
-					Name:       hdr.Name,
-					Typeflag:   hdr.Typeflag,
-					Xattrs:     hdr.Xattrs,
-					PAXRecords: hdr.PAXRecords,
-					Format:     format,
+					Name:        hdr.Name,
+					Typeflag:    hdr.Typeflag,
+					Xattrs:      hdr.Xattrs,
+					PAXRecords:  hdr.PAXRecords,
+					Format:      format,
+					Diagnostics: diagnostics,
 				}, nil
 			}
 			continue // This is a meta header affecting the next header
@@ -199,6 +235,7 @@ func (tr *Reader) next() (*Header, error) {
 				format.mayOnlyBe(FormatUSTAR)
 			}
 			hdr.Format = format
+			hdr.Diagnostics = diagnostics
 			return hdr, nil // This is a file, so stop
 		}
 	}
@@ -289,6 +326,14 @@ func (tr *Reader) readGNUSparsePAXHeaders(hdr *Header) (sparseDatas, error) {
 	return readGNUSparseMap0x1(hdr.PAXRecords)
 }
 
+// MergePAX merges paxHdrs into hdr for all relevant fields of Header, the way
+// Next does for the records of extended headers, and sets hdr.PAXRecords to
+// paxHdrs. Next does not apply the records of global extended headers
+// (TypeXGlobalHeader) to the following headers, callers may do so with it.
+func MergePAX(hdr *Header, paxHdrs map[string]string) error {
+	return mergePAX(hdr, paxHdrs)
+}
+
 // mergePAX merges paxHdrs into hdr for all relevant fields of Header.
 func mergePAX(hdr *Header, paxHdrs map[string]string) (err error) {
 	for k, v := range paxHdrs {
@@ -335,6 +380,68 @@ func mergePAX(hdr *Header, paxHdrs map[string]string) (err error) {
 	return nil
 }
 
+// ParseRecords parses the records of an extended header, like the data of a
+// TypeSolarisXHeader entry, which Reader returns as it is, rather than merging
+// it into the next header as it does with TypeXHeader.
+func ParseRecords(r io.Reader) (map[string]string, error) {
+	// the data of an entry is not accounted for in Reader.RawBytes
+	return parsePAX(struct{ io.Reader }{r})
+}
+
+// Types of the ACL in the data of a TypeSolarisACL entry, in the high bits of
+// the number leading it.
+const (
+	solarisACLPOSIX = 01000000
+	solarisACLNFSv4 = 03000000
+)
+
+// ParseSolarisACL parses the data of a TypeSolarisACL entry: an octal number,
+// of the type of the ACL and its count of entries, then the entries in their
+// text form, separated by commas, each part ended with a NUL. The entries of
+// the default ACL of a POSIX.1e ACL, prefixed with "default:", are returned
+// in ACL.Default without the prefix.
+func ParseSolarisACL(r io.Reader) (ACL, error) {
+	// the data of an entry is not accounted for in Reader.RawBytes
+	buf, err := readSpecialFile(struct{ io.Reader }{r})
+	if err != nil {
+		return ACL{}, err
+	}
+	text := string(buf)
+	i := strings.IndexByte(text, 0)
+	if i < 0 {
+		return ACL{}, ErrHeader
+	}
+	n, err := strconv.ParseUint(text[:i], 8, 32)
+	if err != nil {
+		return ACL{}, ErrHeader
+	}
+	text = text[i+1:]
+	if i := strings.IndexByte(text, 0); i >= 0 {
+		text = text[:i]
+	}
+	entries := splitRecordList(text)
+	if uint64(len(entries)) != n&0777777 {
+		return ACL{}, ErrHeader
+	}
+
+	var acl ACL
+	switch n &^ 0777777 {
+	case solarisACLPOSIX:
+		for _, e := range entries {
+			if d := strings.TrimPrefix(e, "default:"); d != e {
+				acl.Default = append(acl.Default, d)
+			} else {
+				acl.Access = append(acl.Access, e)
+			}
+		}
+	case solarisACLNFSv4:
+		acl.NFSv4 = entries
+	default:
+		return ACL{}, ErrHeader
+	}
+	return acl, nil
+}
+
 // parsePAX parses PAX headers.
 // If an extended header (type 'x') is invalid, ErrHeader is returned
 func parsePAX(r io.Reader) (map[string]string, error) {
@@ -400,6 +507,16 @@ func (tr *Reader) readHeader() (*Header, *block, error) {
 		return nil, nil, err // EOF is okay here; exactly 0 bytes read
 	}
 
+	for tr.IgnoreZeros && bytes.Equal(tr.blk[:], zeroBlock[:]) {
+		n, err = io.ReadFull(tr.r, tr.blk[:])
+		if tr.RawAccounting && (err == nil || err == io.EOF) {
+			tr.rawBytes.Write(tr.blk[:n])
+		}
+		if err != nil {
+			return nil, nil, err // EOF is okay here; exactly 0 bytes read
+		}
+	}
+
 	if bytes.Equal(tr.blk[:], zeroBlock[:]) {
 		n, err = io.ReadFull(tr.r, tr.blk[:])
 		if tr.RawAccounting && (err == nil || err == io.EOF) {
@@ -415,12 +532,22 @@ func (tr *Reader) readHeader() (*Header, *block, error) {
 	}
 
 	// Verify the header matches a known format.
-	format := tr.blk.GetFormat()
+	p := parser{leniency: tr.Leniency}
+	format := tr.blk.getFormat(&p)
 	if format == FormatUnknown {
 		return nil, nil, ErrHeader
 	}
 
-	var p parser
+	// parseField parses a numeric field, with the diagnostics about it.
+	parseField := func(field string, b []byte) int64 {
+		n := len(p.diagnostics)
+		if b[0]&0x80 != 0 && !format.has(FormatGNU|formatSTAR) {
+			p.diagnose("base-256 number outside of the GNU and STAR formats")
+		}
+		x := p.parseNumeric(b)
+		p.tagDiagnostics(n, field)
+		return x
+	}
 	hdr := new(Header)
 
 	// Unpack the V7 header.
@@ -428,19 +555,19 @@ func (tr *Reader) readHeader() (*Header, *block, error) {
 	hdr.Typeflag = v7.TypeFlag()[0]
 	hdr.Name = p.parseString(v7.Name())
 	hdr.Linkname = p.parseString(v7.LinkName())
-	hdr.Size = p.parseNumeric(v7.Size())
-	hdr.Mode = p.parseNumeric(v7.Mode())
-	hdr.Uid = int(p.parseNumeric(v7.UID()))
-	hdr.Gid = int(p.parseNumeric(v7.GID()))
-	hdr.ModTime = time.Unix(p.parseNumeric(v7.ModTime()), 0)
+	hdr.Size = parseField("size", v7.Size())
+	hdr.Mode = parseField("mode", v7.Mode())
+	hdr.Uid = int(parseField("uid", v7.UID()))
+	hdr.Gid = int(parseField("gid", v7.GID()))
+	hdr.ModTime = time.Unix(parseField("mtime", v7.ModTime()), 0)
 
 	// Unpack format specific fields.
 	if format > formatV7 {
 		ustar := tr.blk.USTAR()
 		hdr.Uname = p.parseString(ustar.UserName())
 		hdr.Gname = p.parseString(ustar.GroupName())
-		hdr.Devmajor = p.parseNumeric(ustar.DevMajor())
-		hdr.Devminor = p.parseNumeric(ustar.DevMinor())
+		hdr.Devmajor = parseField("devmajor", ustar.DevMajor())
+		hdr.Devminor = parseField("devminor", ustar.DevMinor())
 
 		var prefix string
 		switch {
@@ -463,8 +590,8 @@ func (tr *Reader) readHeader() (*Header, *block, error) {
 		case format.has(formatSTAR):
 			star := tr.blk.STAR()
 			prefix = p.parseString(star.Prefix())
-			hdr.AccessTime = time.Unix(p.parseNumeric(star.AccessTime()), 0)
-			hdr.ChangeTime = time.Unix(p.parseNumeric(star.ChangeTime()), 0)
+			hdr.AccessTime = time.Unix(parseField("atime", star.AccessTime()), 0)
+			hdr.ChangeTime = time.Unix(parseField("ctime", star.ChangeTime()), 0)
 		case format.has(FormatGNU):
 			hdr.Format = format
 			var p2 parser
@@ -510,6 +637,7 @@ func (tr *Reader) readHeader() (*Header, *block, error) {
 			hdr.Name = prefix + "/" + hdr.Name
 		}
 	}
+	hdr.Diagnostics = p.diagnostics
 	return hdr, &tr.blk, p.err
 }
 
@@ -525,7 +653,7 @@ func (tr *Reader) readOldGNUSparseMap(hdr *Header, blk *block) (sparseDatas, err
 	// Make sure that the input format is GNU.
 	// Unfortunately, the STAR format also has a sparse header format that uses
 	// the same type flag but has a completely different layout.
-	if blk.GetFormat() != FormatGNU {
+	if blk.getFormat(&parser{leniency: tr.Leniency}) != FormatGNU {
 		return nil, ErrHeader
 	}
 	hdr.Format.mayOnlyBe(FormatGNU)
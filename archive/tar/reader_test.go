@@ -694,6 +694,187 @@ func TestReader(t *testing.T) {
 	}
 }
 
+func TestReadIgnoreZeros(t *testing.T) {
+	var want []string
+	var concatenated bytes.Buffer
+	for _, name := range []string{"a", "b"} {
+		tw := NewWriter(&concatenated)
+		if err := tw.WriteHeader(&Header{Name: name, Mode: 0644, Size: 1}); err != nil {
+			t.Fatalf("WriteHeader() = %v", err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("Close() = %v", err)
+		}
+		want = append(want, name)
+	}
+
+	for _, ignoreZeros := range []bool{false, true} {
+		var got []string
+		var raw bytes.Buffer
+		tr := NewReader(bytes.NewReader(concatenated.Bytes()))
+		tr.RawAccounting = true
+		tr.IgnoreZeros = ignoreZeros
+		for {
+			hdr, err := tr.Next()
+			raw.Write(tr.RawBytes())
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Next() = %v", err)
+			}
+			got = append(got, hdr.Name)
+			if _, err := io.Copy(&raw, tr); err != nil {
+				t.Fatalf("Copy() = %v", err)
+			}
+		}
+		if !ignoreZeros {
+			if !reflect.DeepEqual(got, want[:1]) {
+				t.Errorf("names = %q, want %q", got, want[:1])
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("IgnoreZeros: names = %q, want %q", got, want)
+		}
+		if !bytes.Equal(raw.Bytes(), concatenated.Bytes()) {
+			t.Errorf("IgnoreZeros: raw bytes do not make up the archive")
+		}
+	}
+
+	tr := NewReader(bytes.NewReader(append(concatenated.Bytes(), 0)))
+	tr.IgnoreZeros = true
+	var err error
+	for err == nil {
+		_, err = tr.Next()
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Next() = %v, want %v after a partial block", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestReadLeniency(t *testing.T) {
+	var buf bytes.Buffer
+	tw := NewWriter(&buf)
+	hdr := &Header{Name: "file", Mode: 0644, Uid: 1, ModTime: time.Unix(0, 0), Format: FormatUSTAR}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatalf("WriteHeader() = %v", err)
+	}
+	var base block
+	copy(base[:], buf.Bytes())
+	sum, _ := base.ComputeChecksum()
+
+	// setChksum writes the checksum of the block, as pick chooses it.
+	setChksum := func(b *block, pick func(unsigned, signed int64) int64) {
+		var f formatter
+		f.formatOctal(b.V7().Chksum()[:7], pick(b.ComputeChecksum()))
+		b.V7().Chksum()[7] = ' '
+	}
+	unsigned := func(unsigned, _ int64) int64 { return unsigned }
+
+	vectors := []struct {
+		label    string
+		mutate   func(b *block)
+		accepted Leniency // Least leniency accepting the header
+		diags    []string
+		check    func(hdr *Header) bool
+	}{{
+		label:    "conforming",
+		mutate:   func(b *block) {},
+		accepted: Strict,
+	}, {
+		label: "signed checksum",
+		mutate: func(b *block) {
+			b.V7().Name()[1] = 0xe9
+			setChksum(b, func(_, signed int64) int64 { return signed })
+		},
+		accepted: Strict,
+		diags:    []string{"chksum: checksum computed over signed bytes"},
+	}, {
+		label: "unterminated mode",
+		mutate: func(b *block) {
+			copy(b.V7().Mode(), "00000755")
+			setChksum(b, unsigned)
+		},
+		accepted: Strict,
+		diags:    []string{"mode: octal number not terminated by a NUL or space"},
+		check:    func(hdr *Header) bool { return hdr.Mode == 0755 },
+	}, {
+		label: "junk in uid",
+		mutate: func(b *block) {
+			copy(b.V7().UID(), "00017x9\x00")
+			setChksum(b, unsigned)
+		},
+		accepted: LenientNumeric,
+		diags:    []string{`uid: invalid octal number "00017x9" read as 15`},
+		check:    func(hdr *Header) bool { return hdr.Uid == 15 },
+	}, {
+		label: "base-256 uid",
+		mutate: func(b *block) {
+			copy(b.V7().UID(), "\x80\x00\x00\x00\x00\x00\x00\x07")
+			setChksum(b, unsigned)
+		},
+		accepted: Strict,
+		diags:    []string{"uid: base-256 number outside of the GNU and STAR formats"},
+		check:    func(hdr *Header) bool { return hdr.Uid == 7 },
+	}, {
+		label: "base-256 checksum",
+		mutate: func(b *block) {
+			chksum := b.V7().Chksum()
+			copy(chksum, "\x80\x00\x00\x00\x00\x00")
+			chksum[6], chksum[7] = byte(sum>>8), byte(sum)
+		},
+		accepted: LenientNumeric,
+		diags:    []string{"chksum: checksum encoded in base-256"},
+	}, {
+		label: "wrong checksum",
+		mutate: func(b *block) {
+			setChksum(b, func(unsigned, _ int64) int64 { return unsigned + 1 })
+		},
+		accepted: LenientChecksum,
+		diags:    []string{fmt.Sprintf("chksum: checksum %d should be %d", sum+1, sum)},
+	}}
+
+	for _, v := range vectors {
+		b := base
+		v.mutate(&b)
+		archive := append(b[:], make([]byte, 2*blockSize)...)
+
+		for l := Strict; l <= LenientChecksum; l++ {
+			tr := NewReader(bytes.NewReader(archive))
+			tr.Leniency = l
+			got, err := tr.Next()
+			if l < v.accepted {
+				if err != ErrHeader {
+					t.Errorf("%s, leniency %d: Next() = %v, want %v", v.label, l, err, ErrHeader)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s, leniency %d: Next() = %v", v.label, l, err)
+				continue
+			}
+			var diags []string
+			for _, d := range got.Diagnostics {
+				diags = append(diags, d.String())
+			}
+			want := v.diags
+			if l == Strict {
+				want = nil
+			}
+			if !reflect.DeepEqual(diags, want) {
+				t.Errorf("%s, leniency %d: diagnostics = %q, want %q", v.label, l, diags, want)
+			}
+			if v.check != nil && !v.check(got) {
+				t.Errorf("%s, leniency %d: unexpected header %+v", v.label, l, got)
+			}
+		}
+	}
+}
+
 func TestPartialRead(t *testing.T) {
 	type testCase struct {
 		cnt    int    // Number of bytes to read
@@ -44,6 +44,25 @@ func toASCII(s string) string {
 
 type parser struct {
 	err error // Last error seen
+
+	leniency    Leniency     // Deviations from the format to accept
+	diagnostics []Diagnostic // Deviations accepted, if diagnosing
+}
+
+// diagnose records a deviation from the format, with its field left to be
+// set by the caller, see tagDiagnostics.
+func (p *parser) diagnose(msg string) {
+	if p.leniency >= Diagnose {
+		p.diagnostics = append(p.diagnostics, Diagnostic{Message: msg})
+	}
+}
+
+// tagDiagnostics sets the field of the diagnostics recorded since there
+// were n of them.
+func (p *parser) tagDiagnostics(n int, field string) {
+	for i := n; i < len(p.diagnostics); i++ {
+		p.diagnostics[i].Field = field
+	}
 }
 
 type formatter struct {
@@ -161,12 +180,26 @@ func (p *parser) parseOctal(b []byte) int64 {
 	// spaces or NULs.
 	// So we remove leading and trailing NULs and spaces to
 	// be sure.
+	if n := len(b); n > 0 && b[n-1] >= '0' && b[n-1] <= '7' {
+		p.diagnose("octal number not terminated by a NUL or space")
+	}
 	b = bytes.Trim(b, " \x00")
 
 	if len(b) == 0 {
 		return 0
 	}
-	x, perr := strconv.ParseUint(p.parseString(b), 8, 64)
+	s := p.parseString(b)
+	x, perr := strconv.ParseUint(s, 8, 64)
+	if perr != nil && p.leniency >= LenientNumeric {
+		// Keep the value of the leading octal digits, as some legacy
+		// readers do.
+		notOctal := func(r rune) bool { return r < '0' || r > '7' }
+		if i := strings.IndexFunc(s, notOctal); i >= 0 {
+			if x, perr = strconv.ParseUint("0"+s[:i], 8, 64); perr == nil {
+				p.diagnose(fmt.Sprintf("invalid octal number %q read as %d", s, x))
+			}
+		}
+	}
 	if perr != nil {
 		p.err = ErrHeader
 	}
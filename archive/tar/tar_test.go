@@ -337,6 +337,155 @@ func TestRoundTrip(t *testing.T) {
 	}
 }
 
+func TestVendorExtensions(t *testing.T) {
+	acl := ACL{
+		Access: []string{"user::rw-", "user:bin:r--:2", "group::r--", "mask::r--", "other::r--"},
+		NFSv4:  []string{"owner@:rwxp--aARWcCos:-------:allow:0"},
+	}
+	hdr := &Header{
+		Name:       "file.txt",
+		Mode:       0644,
+		ModTime:    time.Unix(0, 0),
+		Typeflag:   TypeReg,
+		PAXRecords: map[string]string{"LIBARCHIVE.creationtime": "1500000000"},
+	}
+	hdr.SetACL(acl)
+	hdr.SetFileFlags([]string{"uchg", "nodump"})
+
+	var b bytes.Buffer
+	tw := NewWriter(&b)
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatalf("WriteHeader() = %v", err)
+	}
+	// a Solaris extended header, kept as an entry of its own
+	rec, err := formatPAXRecord("SUN.devmajor", "7")
+	if err != nil {
+		t.Fatalf("formatPAXRecord() = %v", err)
+	}
+	if err := tw.WriteHeader(&Header{Name: "X.file", Typeflag: TypeSolarisXHeader, Size: int64(len(rec)), Format: FormatUSTAR}); err != nil {
+		t.Fatalf("WriteHeader() = %v", err)
+	}
+	if _, err := io.WriteString(tw, rec); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	tr := NewReader(&b)
+	got, err := tr.Next()
+	if err != nil {
+		t.Fatalf("Next() = %v", err)
+	}
+	if !reflect.DeepEqual(got.ACL(), acl) {
+		t.Errorf("ACL() = %+v, want %+v", got.ACL(), acl)
+	}
+	if flags := got.FileFlags(); !reflect.DeepEqual(flags, []string{"uchg", "nodump"}) {
+		t.Errorf("FileFlags() = %q", flags)
+	}
+	if records := got.VendorRecords("LIBARCHIVE"); !reflect.DeepEqual(records, map[string]string{"creationtime": "1500000000"}) {
+		t.Errorf("VendorRecords(LIBARCHIVE) = %v", records)
+	}
+	if records := got.VendorRecords("SUN"); records != nil {
+		t.Errorf("VendorRecords(SUN) = %v, want nil", records)
+	}
+
+	got, err = tr.Next()
+	if err != nil {
+		t.Fatalf("Next() = %v", err)
+	}
+	if got.Typeflag != TypeSolarisXHeader {
+		t.Errorf("Typeflag = %q, want %q", got.Typeflag, TypeSolarisXHeader)
+	}
+	records, err := ParseRecords(tr)
+	if err != nil {
+		t.Fatalf("ParseRecords() = %v", err)
+	}
+	if !reflect.DeepEqual(records, map[string]string{"SUN.devmajor": "7"}) {
+		t.Errorf("ParseRecords() = %v", records)
+	}
+
+	got.SetACL(ACL{})
+	got.SetFileFlags(nil)
+	if len(got.PAXRecords) != 0 {
+		t.Errorf("PAXRecords = %v after clearing the ACL and the file flags", got.PAXRecords)
+	}
+}
+
+func TestSolarisACL(t *testing.T) {
+	vectors := []struct {
+		data string
+		want ACL
+		ok   bool
+	}{{
+		data: "1000005\x00user::rw-,user:bin:r--:2,group::r--,mask:r--,other:r--\x00",
+		want: ACL{Access: []string{"user::rw-", "user:bin:r--:2", "group::r--", "mask:r--", "other:r--"}},
+		ok:   true,
+	}, {
+		data: "1000004\x00user::rwx,group::r-x,default:user::rwx,default:other:r-x\x00",
+		want: ACL{
+			Access:  []string{"user::rwx", "group::r-x"},
+			Default: []string{"user::rwx", "other:r-x"},
+		},
+		ok: true,
+	}, {
+		data: "3000001\x00owner@:rwxp--aARWcCos:-------:allow\x00",
+		want: ACL{NFSv4: []string{"owner@:rwxp--aARWcCos:-------:allow"}},
+		ok:   true,
+	}, {
+		data: "1000000\x00\x00",
+		ok:   true,
+	}, {
+		data: "1000002\x00user::rw-\x00", // count mismatch
+	}, {
+		data: "2000001\x00user::rw-\x00", // unknown type
+	}, {
+		data: "100000z\x00user::rw-\x00",
+	}, {
+		data: "user::rw-,group::r--,other::r--",
+	}}
+
+	for i, v := range vectors {
+		got, err := ParseSolarisACL(strings.NewReader(v.data))
+		if ok := err == nil; ok != v.ok {
+			t.Errorf("test %d, ParseSolarisACL(%q): got %v, want ok %v", i, v.data, err, v.ok)
+			continue
+		}
+		if v.ok && !reflect.DeepEqual(got, v.want) {
+			t.Errorf("test %d, ParseSolarisACL(%q) = %+v, want %+v", i, v.data, got, v.want)
+		}
+	}
+
+	// the headers of an archive made by star have no ACL or vendor records
+	f, err := os.Open("testdata/star.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr := NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		if hdr.Typeflag != TypeReg {
+			t.Errorf("%s: Typeflag = %q, want %q", hdr.Name, hdr.Typeflag, TypeReg)
+		}
+		if acl := hdr.ACL(); !reflect.DeepEqual(acl, ACL{}) {
+			t.Errorf("%s: ACL() = %+v, want none", hdr.Name, acl)
+		}
+		if flags := hdr.FileFlags(); flags != nil {
+			t.Errorf("%s: FileFlags() = %q, want nil", hdr.Name, flags)
+		}
+		if records := hdr.VendorRecords("SCHILY"); records != nil {
+			t.Errorf("%s: VendorRecords(SCHILY) = %v, want nil", hdr.Name, records)
+		}
+	}
+}
+
 type headerRoundTripTest struct {
 	h  *Header
 	fm os.FileMode
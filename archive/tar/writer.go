@@ -107,6 +107,38 @@ func (tw *Writer) WriteHeader(hdr *Header) error {
 	}
 }
 
+// WriteRawHeader writes raw, the bytes of a header including any extended
+// headers, like those a Reader with RawAccounting reads, and prepares to
+// accept the contents of the file hdr describes, hdr being what raw decodes
+// to. The raw bytes are not validated against hdr.
+// Sparse files are not supported.
+func (tw *Writer) WriteRawHeader(raw []byte, hdr *Header) error {
+	if len(raw) == 0 || len(raw)%blockSize != 0 {
+		return ErrHeader
+	}
+	if hdr.Typeflag == TypeGNUSparse {
+		return headerError{"sparse files are not supported"}
+	}
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, paxGNUSparse) {
+			return headerError{"sparse files are not supported"}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if _, tw.err = tw.w.Write(raw); tw.err != nil {
+		return tw.err
+	}
+	size := hdr.Size
+	if isHeaderOnlyType(hdr.Typeflag) {
+		size = 0
+	}
+	tw.curr = &regFileWriter{tw.w, size}
+	tw.pad = blockPadding(size)
+	return nil
+}
+
 func (tw *Writer) writeUSTARHeader(hdr *Header) error {
 	// Check if we can use USTAR prefix/suffix splitting.
 	var namePrefix string
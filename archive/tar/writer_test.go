@@ -834,6 +834,65 @@ func (w *failOnceWriter) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+func TestWriteRawHeader(t *testing.T) {
+	var want bytes.Buffer
+	tw := NewWriter(&want)
+	files := []struct {
+		hdr  Header
+		body string
+	}{
+		{Header{Name: "dir/", Typeflag: TypeDir, Mode: 0755}, ""},
+		{Header{Name: "dir/" + strings.Repeat("long", 40), Typeflag: TypeReg, Mode: 0644, Size: 5}, "hello"},
+		{Header{Name: "xattrs", Typeflag: TypeReg, Mode: 0600, Size: 3, PAXRecords: map[string]string{"SCHILY.xattr.user.foo": "bar"}}, "abc"},
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&f.hdr); err != nil {
+			t.Fatalf("WriteHeader() = %v", err)
+		}
+		if _, err := io.WriteString(tw, f.body); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	// rewrite the archive from the raw headers
+	var got bytes.Buffer
+	tw = NewWriter(&got)
+	tr := NewReader(bytes.NewReader(want.Bytes()))
+	tr.RawAccounting = true
+	for {
+		padding := tr.ExpectedPadding()
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		if err := tw.WriteRawHeader(tr.RawBytes()[padding:], hdr); err != nil {
+			t.Fatalf("WriteRawHeader() = %v", err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			t.Fatalf("Copy() = %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("output mismatch:\n%s", bytediff(got.Bytes(), want.Bytes()))
+	}
+
+	if err := NewWriter(io.Discard).WriteRawHeader(make([]byte, 100), &Header{}); err != ErrHeader {
+		t.Errorf("WriteRawHeader(short) = %v, want %v", err, ErrHeader)
+	}
+	if err := NewWriter(io.Discard).WriteRawHeader(make([]byte, blockSize), &Header{Typeflag: TypeGNUSparse}); err == nil {
+		t.Errorf("WriteRawHeader(sparse) = nil, want error")
+	}
+}
+
 func TestWriterErrors(t *testing.T) {
 	t.Run("HeaderOnly", func(t *testing.T) {
 		tw := NewWriter(new(bytes.Buffer))
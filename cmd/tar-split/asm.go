@@ -7,6 +7,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"github.com/vbatts/tar-split/archive/tar"
 	"github.com/vbatts/tar-split/tar/asm"
 	"github.com/vbatts/tar-split/tar/storage"
 )
@@ -55,16 +56,66 @@ func CommandAsm(c *cli.Context) {
 	}
 	defer mfz.Close()
 
-	metaUnpacker := storage.NewJSONUnpacker(mfz)
+	var metaUnpacker storage.Unpacker = storage.NewJSONUnpacker(mfz)
+	if len(c.String("pubkey")) > 0 {
+		metaUnpacker, err = verifyMetadata(metaUnpacker, c.String("pubkey"), c.String("signature"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	} else if len(c.String("signature")) > 0 {
+		logrus.Fatalf("--signature requires --pubkey")
+	}
 	// XXX maybe get the absolute path here
 	fileGetter := storage.NewPathFileGetter(c.String("path"))
 
-	ots := asm.NewOutputTarStream(fileGetter, metaUnpacker)
-	defer ots.Close()
-	i, err := io.Copy(outputStream, ots)
+	var i int64
+	if len(c.StringSlice("include")) > 0 || len(c.StringSlice("exclude")) > 0 {
+		i, err = filterTarStream(c, fileGetter, metaUnpacker, outputStream)
+	} else {
+		ots := asm.NewOutputTarStream(fileGetter, metaUnpacker)
+		defer ots.Close()
+		i, err = io.Copy(outputStream, ots)
+	}
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
 	logrus.Infof("created %s from %s and %s (wrote %d bytes)", c.String("output"), c.String("path"), c.String("input"), i)
 }
+
+// filterTarStream writes the files selected by --include and --exclude to w,
+// and their metadata to --filtered-metadata, if set.
+func filterTarStream(c *cli.Context, fg storage.FileGetter, up storage.Unpacker, w io.Writer) (int64, error) {
+	filter, err := asm.NewPathFilter(c.StringSlice("include"), c.StringSlice("exclude"))
+	if err != nil {
+		return 0, err
+	}
+	metaOutput := io.Discard
+	if len(c.String("filtered-metadata")) > 0 {
+		mf, err := os.OpenFile(c.String("filtered-metadata"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(0600))
+		if err != nil {
+			return 0, err
+		}
+		defer mf.Close()
+		mfz := gzip.NewWriter(mf)
+		defer mfz.Close()
+		metaOutput = mfz
+	}
+	cw := &countingWriter{w: w}
+	keep := func(hdr *tar.Header) bool {
+		return filter.Match(hdr.Name)
+	}
+	err = asm.FilterTarStream(fg, up, keep, cw, storage.NewJSONPacker(metaOutput), asm.InputOptions{})
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
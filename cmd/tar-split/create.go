@@ -0,0 +1,84 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/vbatts/tar-split/tar/asm"
+)
+
+func CommandCreate(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		logrus.Fatalf("please specify the directory to archive")
+	}
+	if len(c.String("output")) == 0 {
+		logrus.Fatalf("--output filename must be set")
+	}
+	if len(c.String("tar")) == 0 {
+		logrus.Fatalf("--tar filename must be set ([FILENAME|-])")
+	}
+
+	opts := asm.DirOptions{
+		Names:  c.Bool("names"),
+		Xattrs: c.StringSlice("xattr"),
+	}
+	if epoch := c.String("source-date-epoch"); len(epoch) > 0 {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			logrus.Fatalf("invalid SOURCE_DATE_EPOCH %q: %v", epoch, err)
+		}
+		t := time.Unix(sec, 0)
+		opts.SourceDateEpoch = &t
+	}
+	if owner := c.String("owner"); len(owner) > 0 {
+		var o asm.Owner
+		if _, err := fmt.Sscanf(owner, "%d:%d", &o.UID, &o.GID); err != nil {
+			logrus.Fatalf("invalid --owner %q, expected UID:GID: %v", owner, err)
+		}
+		opts.Owner = &o
+	}
+
+	var tarStream io.Writer
+	if c.String("tar") == "-" {
+		tarStream = os.Stdout
+	} else {
+		fh, err := os.Create(c.String("tar"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		defer fh.Close()
+		tarStream = fh
+	}
+
+	// Set up the metadata storage
+	mf, err := os.OpenFile(c.String("output"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(0600))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer mf.Close()
+	mfz := gzip.NewWriter(mf)
+	defer mfz.Close()
+
+	w, err := asm.NewWriterWithOptions(tarStream, newMetadataPacker(c, mfz), nil, asm.InputOptions{
+		SegmentKinds: c.Bool("segment-kinds"),
+		Preamble:     c.Bool("preamble"),
+		Trailer:      c.Bool("trailer"),
+		Producer:     producer(),
+	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if err := asm.WriteDir(w, c.Args()[0], opts); err != nil {
+		logrus.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("created %s and %s from %s", c.String("tar"), c.String("output"), c.Args()[0])
+}
@@ -7,10 +7,19 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"github.com/vbatts/tar-split/archive/tar"
 	"github.com/vbatts/tar-split/tar/asm"
 	"github.com/vbatts/tar-split/tar/storage"
 )
 
+// leniencies are the values of the --leniency flag.
+var leniencies = map[string]tar.Leniency{
+	"strict":   tar.Strict,
+	"diagnose": tar.Diagnose,
+	"numeric":  tar.LenientNumeric,
+	"checksum": tar.LenientChecksum,
+}
+
 func CommandDisasm(c *cli.Context) {
 	if len(c.Args()) != 1 {
 		logrus.Fatalf("please specify tar to be disabled <NAME|->")
@@ -19,6 +28,11 @@ func CommandDisasm(c *cli.Context) {
 		logrus.Fatalf("--output filename must be set")
 	}
 
+	leniency, ok := leniencies[c.String("leniency")]
+	if !ok {
+		logrus.Fatalf("--leniency must be one of strict, diagnose, numeric or checksum")
+	}
+
 	// Set up the tar input stream
 	var inputStream io.Reader
 	if c.Args()[0] == "-" {
@@ -40,11 +54,22 @@ func CommandDisasm(c *cli.Context) {
 	defer mf.Close()
 	mfz := gzip.NewWriter(mf)
 	defer mfz.Close()
-	metaPacker := storage.NewJSONPacker(mfz)
+	metaPacker := newMetadataPacker(c, mfz)
 
 	// we're passing nil here for the file putter, because the ApplyDiff will
 	// handle the extraction of the archive
-	its, err := asm.NewInputTarStream(inputStream, metaPacker, nil)
+	opts := asm.InputOptions{
+		SegmentKinds: c.Bool("segment-kinds"),
+		IgnoreZeros:  c.Bool("ignore-zeros"),
+		Leniency:     leniency,
+		Preamble:     c.Bool("preamble"),
+		Trailer:      c.Bool("trailer"),
+		Producer:     producer(),
+	}
+	if c.Bool("salvage") {
+		opts.Salvage = &asm.SalvageReport{}
+	}
+	its, err := asm.NewInputTarStreamWithOptions(inputStream, metaPacker, nil, opts)
 	if err != nil {
 		logrus.Fatal(err)
 	}
@@ -58,5 +83,23 @@ func CommandDisasm(c *cli.Context) {
 	if err != nil {
 		logrus.Fatal(err)
 	}
+	if opts.Salvage != nil && opts.Salvage.Err != nil {
+		logrus.Warnf("%s is damaged: %s", c.Args()[0], opts.Salvage)
+	}
 	logrus.Infof("created %s from %s (read %d bytes)", c.String("output"), c.Args()[0], i)
 }
+
+// newMetadataPacker returns the storage.Packer writing the metadata to w, as
+// set by the --checksums and --zero-runs flags.
+func newMetadataPacker(c *cli.Context, w io.Writer) storage.Packer {
+	var p storage.Packer
+	if c.Bool("checksums") {
+		p = storage.NewJSONPackerWithChecksums(w)
+	} else {
+		p = storage.NewJSONPacker(w)
+	}
+	if c.Bool("zero-runs") {
+		p = storage.NewZeroRunPacker(p)
+	}
+	return p
+}
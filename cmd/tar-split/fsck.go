@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/asm"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func CommandFsck(c *cli.Context) {
+	if len(c.Args()) > 0 {
+		logrus.Warnf("%d additional arguments passed are ignored", len(c.Args()))
+	}
+	if len(c.String("input")) == 0 {
+		logrus.Fatalf("--input filename must be set")
+	}
+
+	mf, err := os.Open(c.String("input"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer mf.Close()
+	mfz, err := gzip.NewReader(mf)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer mfz.Close()
+
+	metadata, err := io.ReadAll(mfz)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	problems, err := asm.Check(storage.NewJSONUnpackerWithDuplicates(bytes.NewReader(metadata)))
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if c.Bool("diagnostics") {
+		var headers, deviating int
+		err := asm.IterateHeaders(storage.NewJSONUnpackerWithDuplicates(bytes.NewReader(metadata)), func(hdr *tar.Header) error {
+			headers++
+			if len(hdr.Diagnostics) > 0 {
+				deviating++
+			}
+			for _, d := range hdr.Diagnostics {
+				fmt.Printf("%q: %s\n", hdr.Name, d)
+			}
+			return nil
+		})
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("%s: %d of %d headers deviate from the tar format", c.String("input"), deviating, headers)
+	}
+	if len(problems) > 0 {
+		logrus.Fatalf("%s: %d problems found", c.String("input"), len(problems))
+	}
+	logrus.Infof("%s: no problems found", c.String("input"))
+}
@@ -9,6 +9,11 @@ import (
 
 var Version = "v0.12.1"
 
+// producer identifies this program in the preamble of the metadata.
+func producer() string {
+	return "tar-split " + Version
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "tar-split"
@@ -47,6 +52,93 @@ func main() {
 					Name:  "no-stdout",
 					Usage: "do not throughput the stream to STDOUT",
 				},
+				cli.BoolFlag{
+					Name:  "checksums",
+					Usage: "record a checksum of each metadata entry",
+				},
+				cli.BoolFlag{
+					Name:  "zero-runs",
+					Usage: "store segments of zero bytes, like padding, as their length",
+				},
+				cli.BoolFlag{
+					Name:  "segment-kinds",
+					Usage: "store the headers and the padding in separate segments, recording their kind",
+				},
+				cli.BoolFlag{
+					Name:  "preamble",
+					Usage: "lead the metadata with a preamble recording its version, producer and options",
+				},
+				cli.BoolFlag{
+					Name:  "trailer",
+					Usage: "end the metadata with a trailer recording the size and digest of the archive, verified on assembly",
+				},
+				cli.BoolFlag{
+					Name:  "ignore-zeros",
+					Usage: "read on past end-of-archive markers, through concatenated archives",
+				},
+				cli.BoolFlag{
+					Name:  "salvage",
+					Usage: "store the bytes of a damaged archive from the damage on as they are, and report where it is",
+				},
+				cli.StringFlag{
+					Name:  "leniency",
+					Value: "strict",
+					Usage: "accept malformed headers: strict, diagnose, numeric (bad numeric fields) or checksum (bad checksums too)",
+				},
+			},
+		},
+		{
+			Name:   "create",
+			Usage:  "create a tar archive and its metadata from a directory, deterministically",
+			Action: CommandCreate,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "output",
+					Value: "tar-data.json.gz",
+					Usage: "output of the tar stream metadata",
+				},
+				cli.StringFlag{
+					Name:  "tar",
+					Value: "-",
+					Usage: "output of the tar archive",
+				},
+				cli.StringFlag{
+					Name:   "source-date-epoch",
+					Usage:  "clamp the modification times of the files to this UNIX time",
+					EnvVar: "SOURCE_DATE_EPOCH",
+				},
+				cli.StringFlag{
+					Name:  "owner",
+					Usage: "set the owner of all the files to UID:GID, without names",
+				},
+				cli.BoolFlag{
+					Name:  "names",
+					Usage: "record the user and group names of the owners, as looked up on this host",
+				},
+				cli.StringSliceFlag{
+					Name:  "xattr",
+					Usage: "record the extended attributes matching this pattern, instead of security.capability only (may be repeated)",
+				},
+				cli.BoolFlag{
+					Name:  "checksums",
+					Usage: "record a checksum of each metadata entry",
+				},
+				cli.BoolFlag{
+					Name:  "zero-runs",
+					Usage: "store segments of zero bytes, like padding, as their length",
+				},
+				cli.BoolFlag{
+					Name:  "segment-kinds",
+					Usage: "store the headers and the padding in separate segments, recording their kind",
+				},
+				cli.BoolFlag{
+					Name:  "preamble",
+					Usage: "lead the metadata with a preamble recording its version, producer and options",
+				},
+				cli.BoolFlag{
+					Name:  "trailer",
+					Usage: "end the metadata with a trailer recording the size and digest of the archive, verified on assembly",
+				},
 			},
 		},
 		{
@@ -75,6 +167,87 @@ func main() {
 					Usage: "gzip compress the output",
 					// defaults to false
 				},
+				cli.StringFlag{
+					Name:  "pubkey",
+					Usage: "verify the input is signed by this PEM encoded ed25519 public key before assembly",
+				},
+				cli.StringFlag{
+					Name:  "signature",
+					Usage: "detached signature of the input, for --pubkey",
+				},
+				cli.StringSliceFlag{
+					Name:  "include",
+					Usage: "only assemble the files matching this pattern, like \"/etc/**\" (may be repeated)",
+				},
+				cli.StringSliceFlag{
+					Name:  "exclude",
+					Usage: "do not assemble the files matching this pattern (may be repeated)",
+				},
+				cli.StringFlag{
+					Name:  "filtered-metadata",
+					Usage: "output of the metadata of the archive assembled with --include or --exclude",
+				},
+			},
+		},
+		{
+			Name:   "sign",
+			Usage:  "sign the disassembled tar stream metadata",
+			Action: CommandSign,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "input",
+					Value: "tar-data.json.gz",
+					Usage: "input of disassembled tar stream",
+				},
+				cli.StringFlag{
+					Name:  "key",
+					Usage: "PEM encoded ed25519 private key to sign with",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "output of disassembled tar stream, with the signature appended",
+				},
+				cli.StringFlag{
+					Name:  "detached",
+					Usage: "output of a detached signature, instead of --output",
+				},
+			},
+		},
+		{
+			Name:    "verify-signature",
+			Aliases: []string{"verify"},
+			Usage:   "verify the signature of the disassembled tar stream metadata",
+			Action:  CommandVerifySignature,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "input",
+					Value: "tar-data.json.gz",
+					Usage: "input of disassembled tar stream",
+				},
+				cli.StringFlag{
+					Name:  "pubkey",
+					Usage: "PEM encoded ed25519 public key to verify with",
+				},
+				cli.StringFlag{
+					Name:  "signature",
+					Usage: "detached signature of the input, instead of the embedded one",
+				},
+			},
+		},
+		{
+			Name:   "fsck",
+			Usage:  "check the disassembled tar stream metadata for consistency",
+			Action: CommandFsck,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "input",
+					Value: "tar-data.json.gz",
+					Usage: "input of disassembled tar stream",
+				},
+				cli.BoolFlag{
+					Name:  "diagnostics",
+					Usage: "also list the headers that deviate from the tar format, and how",
+				},
 			},
 		},
 		{
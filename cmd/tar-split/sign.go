@@ -0,0 +1,209 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func CommandSign(c *cli.Context) {
+	if len(c.Args()) > 0 {
+		logrus.Warnf("%d additional arguments passed are ignored", len(c.Args()))
+	}
+	if len(c.String("input")) == 0 {
+		logrus.Fatalf("--input filename must be set")
+	}
+	if len(c.String("key")) == 0 {
+		logrus.Fatalf("--key filename must be set")
+	}
+	if len(c.String("output")) == 0 && len(c.String("detached")) == 0 {
+		logrus.Fatalf("--output or --detached filename must be set")
+	}
+
+	key, err := readPrivateKey(c.String("key"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	mf, err := os.Open(c.String("input"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer mf.Close()
+	mfz, err := gzip.NewReader(mf)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer mfz.Close()
+	metaUnpacker := storage.NewJSONUnpacker(mfz)
+
+	if len(c.String("detached")) > 0 {
+		sig, err := storage.SignDetached(metaUnpacker, key)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if err := os.WriteFile(c.String("detached"), sig, 0o644); err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("created %s, signing %s", c.String("detached"), c.String("input"))
+		return
+	}
+
+	fh, err := os.Create(c.String("output"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer fh.Close()
+	fhz := gzip.NewWriter(fh)
+	defer fhz.Close()
+
+	var sp *storage.SigningPacker
+	for {
+		entry, err := metaUnpacker.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			logrus.Fatal(err)
+		}
+		if sp == nil {
+			// keep the entries checksummed, if they were
+			var p storage.Packer
+			if entry.Checksum != nil {
+				p = storage.NewJSONPackerWithChecksums(fhz)
+			} else {
+				p = storage.NewJSONPacker(fhz)
+			}
+			// and the zero runs compacted, as the unpacker expands them
+			if entry.Type == storage.PreambleType {
+				pre, err := storage.DecodePreamble(entry)
+				if err != nil {
+					logrus.Fatal(err)
+				}
+				if pre.Options["zero_runs"] != "" {
+					p = storage.NewZeroRunPacker(p)
+				}
+				repacked, err := pre.Repacked(p).Entry()
+				if err != nil {
+					logrus.Fatal(err)
+				}
+				entry = &repacked
+			}
+			sp = storage.NewSigningPacker(p, key)
+		}
+		// any previous signature is replaced
+		if entry.Type == storage.SignatureType {
+			continue
+		}
+		if _, err := sp.AddEntry(*entry); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	if sp == nil {
+		logrus.Fatalf("%s: no entries to sign", c.String("input"))
+	}
+	if _, err := sp.Sign(); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("created %s, signing %s", c.String("output"), c.String("input"))
+}
+
+func CommandVerifySignature(c *cli.Context) {
+	if len(c.Args()) > 0 {
+		logrus.Warnf("%d additional arguments passed are ignored", len(c.Args()))
+	}
+	if len(c.String("input")) == 0 {
+		logrus.Fatalf("--input filename must be set")
+	}
+	if len(c.String("pubkey")) == 0 {
+		logrus.Fatalf("--pubkey filename must be set")
+	}
+
+	mf, err := os.Open(c.String("input"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer mf.Close()
+	mfz, err := gzip.NewReader(mf)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer mfz.Close()
+
+	if _, err := verifyMetadata(storage.NewJSONUnpacker(mfz), c.String("pubkey"), c.String("signature")); err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("%s: signature verified", c.String("input"))
+}
+
+// verifyMetadata verifies the metadata from up is signed by the public key in
+// the pubkeyPath file, with the detached signature in the signaturePath file,
+// if set.
+func verifyMetadata(up storage.Unpacker, pubkeyPath, signaturePath string) (storage.Unpacker, error) {
+	pub, err := readPublicKey(pubkeyPath)
+	if err != nil {
+		return nil, err
+	}
+	var detached []byte
+	if len(signaturePath) > 0 {
+		detached, err = os.ReadFile(signaturePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return storage.VerifySignature(up, pub, detached)
+}
+
+// readPrivateKey reads an ed25519 private key, PEM encoded in PKCS #8 form.
+func readPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an %s private key", path, storage.SignatureAlgorithm)
+	}
+	return edKey, nil
+}
+
+// readPublicKey reads an ed25519 public key, PEM encoded in PKIX form.
+func readPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an %s public key", path, storage.SignatureAlgorithm)
+	}
+	return edKey, nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s: no PEM encoded %s", path, blockType)
+	}
+	return block.Bytes, nil
+}
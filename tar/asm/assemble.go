@@ -2,6 +2,8 @@ package asm
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"hash"
 	"hash/crc64"
@@ -36,15 +38,29 @@ func NewOutputTarStream(fg storage.FileGetter, up storage.Unpacker) io.ReadClose
 }
 
 // WriteOutputTarStream writes assembled tar archive to a writer.
+//
+// The file payloads are fetched with storage.GetPayload, so by the checksum
+// recorded in the metadata rather than by name, if the storage.FileGetter
+// supports it.
+//
+// Entries of other types are skipped if they are ignorable, otherwise a
+// *storage.UnknownTypeError is returned.
+//
+// If the metadata has a storage.TrailerType entry, the size and digest of the
+// assembled stream are verified against it, and a *TrailerMismatchError is
+// returned if they do not match. The stream is only digested if the
+// storage.PreambleType entry announces the trailer.
 func WriteOutputTarStream(fg storage.FileGetter, up storage.Unpacker, w io.Writer) error {
 	// ... Since these are interfaces, this is possible, so let's not have a nil pointer
 	if fg == nil || up == nil {
 		return nil
 	}
+	up = storage.NewZeroRunUnpacker(up)
 	var copyBuffer []byte
 	var crcHash hash.Hash
 	var crcSum []byte
 	var multiWriter io.Writer
+	var digester *streamDigester
 	for {
 		entry, err := up.Next()
 		if err != nil {
@@ -62,7 +78,7 @@ func WriteOutputTarStream(fg storage.FileGetter, up storage.Unpacker, w io.Write
 			if entry.Size == 0 {
 				continue
 			}
-			fh, err := fg.Get(entry.GetName())
+			fh, err := storage.GetPayload(fg, entry)
 			if err != nil {
 				return err
 			}
@@ -91,10 +107,74 @@ func WriteOutputTarStream(fg storage.FileGetter, up storage.Unpacker, w io.Write
 				return fmt.Errorf("file integrity checksum failed for %q", entry.GetName())
 			}
 			fh.Close()
+		case storage.PreambleType:
+			pre, err := storage.DecodePreamble(entry)
+			if err != nil {
+				return err
+			}
+			if pre.DigestAlgorithm != "" && digester == nil {
+				// the preamble leads the stream, nothing is written yet
+				digester = newStreamDigester()
+				w = io.MultiWriter(w, digester)
+			}
+		case storage.TrailerType:
+			if digester == nil {
+				return errUnannouncedTrailer(entry)
+			}
+			if err := digester.Verify(entry); err != nil {
+				return err
+			}
+		default:
+			if entry.Type.Critical() {
+				return &storage.UnknownTypeError{Type: entry.Type, Position: entry.Position}
+			}
 		}
 	}
 }
 
+// WriteVerifiedOutputTarStream writes assembled tar archive to a writer, like
+// WriteOutputTarStream, but refuses to assemble it unless the metadata is
+// signed with the key pub: with the detached signature if it is not nil, or
+// else with the signature embedded in the metadata. See
+// storage.VerifySignature.
+//
+// Unlike WriteOutputTarStream, a nil fg or up is an error, as nothing could
+// be verified.
+func WriteVerifiedOutputTarStream(fg storage.FileGetter, up storage.Unpacker, pub ed25519.PublicKey, detached []byte, w io.Writer) error {
+	if fg == nil || up == nil {
+		return errors.New("no FileGetter or Unpacker to assemble and verify the tar stream from")
+	}
+	vup, err := storage.VerifySignature(up, pub, detached)
+	if err != nil {
+		return err
+	}
+	return WriteOutputTarStream(fg, vup, w)
+}
+
+// copyPayload writes the payload of a FileType entry to w, verifying its
+// checksum.
+func copyPayload(w io.Writer, fg storage.FileGetter, entry *storage.Entry) error {
+	if entry.Size == 0 {
+		return nil
+	}
+	fh, err := storage.GetPayload(fg, entry)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	c := crc64.New(storage.CRCTable)
+	buf := byteBufferPool.Get().([]byte)
+	//nolint:staticcheck // SA6002 not going to do a pointer here
+	defer byteBufferPool.Put(buf)
+	if _, err := copyWithBuffer(io.MultiWriter(w, c), fh, buf); err != nil {
+		return err
+	}
+	if !bytes.Equal(c.Sum(nil), entry.Payload) {
+		return fmt.Errorf("file integrity checksum failed for %q", entry.GetName())
+	}
+	return nil
+}
+
 var byteBufferPool = &sync.Pool{
 	New: func() interface{} {
 		return make([]byte, 32*1024)
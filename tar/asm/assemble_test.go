@@ -3,13 +3,18 @@ package asm
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/ed25519"
 	"crypto/sha1"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/crc64"
 	"io"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/vbatts/tar-split/archive/tar"
 	"github.com/vbatts/tar-split/tar/storage"
 )
 
@@ -254,3 +259,328 @@ func BenchmarkAsm(b *testing.B) {
 		}
 	}
 }
+
+func TestTarStreamCAS(t *testing.T) {
+	root := t.TempDir()
+	for _, tc := range testCases[:5] {
+		fh, err := os.Open(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fh.Close()
+		gzRdr, err := gzip.NewReader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gzRdr.Close()
+
+		w := bytes.NewBuffer([]byte{})
+		sp := storage.NewJSONPacker(w)
+		fgp, err := storage.NewCASFileGetPutter(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tarStream, err := NewInputTarStream(gzRdr, sp, fgp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, tarStream); err != nil {
+			t.Fatal(err)
+		}
+
+		// a fresh getter only knows the payloads by their checksum
+		fg, err := storage.NewCASFileGetPutter(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sup := storage.NewJSONUnpacker(bytes.NewBuffer(w.Bytes()))
+		h1 := sha1.New()
+		if err := WriteOutputTarStream(fg, sup, h1); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%x", h1.Sum(nil)) != tc.expectedSHA1Sum {
+			t.Fatalf("checksum of output tar %q: expected %s; got %x", tc.path, tc.expectedSHA1Sum, h1.Sum(nil))
+		}
+	}
+}
+
+func TestTarStreamFromTar(t *testing.T) {
+	for _, tc := range testCases[:5] {
+		fh, err := os.Open(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fh.Close()
+		gzRdr, err := gzip.NewReader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gzRdr.Close()
+		tarball, err := io.ReadAll(gzRdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := bytes.NewBuffer([]byte{})
+		tarStream, err := NewInputTarStream(bytes.NewReader(tarball), storage.NewJSONPacker(w), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, tarStream); err != nil {
+			t.Fatal(err)
+		}
+
+		// serve the payloads from the archive itself
+		fg, err := storage.NewTarFileGetter(bytes.NewReader(tarball))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h1 := sha1.New()
+		if err := WriteOutputTarStream(fg, storage.NewJSONUnpacker(w), h1); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%x", h1.Sum(nil)) != tc.expectedSHA1Sum {
+			t.Fatalf("checksum of output tar %q: expected %s; got %x", tc.path, tc.expectedSHA1Sum, h1.Sum(nil))
+		}
+	}
+}
+
+func TestTarStreamTrailer(t *testing.T) {
+	fh, err := os.Open(testCases[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	gzRdr, err := gzip.NewReader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gzRdr.Close()
+
+	w := bytes.NewBuffer([]byte{})
+	fgp := storage.NewBufferFileGetPutter()
+	tarStream, err := NewInputTarStreamWithOptions(gzRdr, storage.NewJSONPacker(w), fgp, InputOptions{Trailer: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, tarStream); err != nil {
+		t.Fatal(err)
+	}
+
+	var packed []storage.Entry
+	sup := storage.NewJSONUnpacker(w)
+	for {
+		entry, err := sup.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatal(err)
+		}
+		packed = append(packed, *entry)
+	}
+	trailer := packed[len(packed)-1]
+	if trailer.Type != storage.TrailerType || trailer.Size != testCases[0].expectedSize {
+		t.Fatalf("expected a trailer for %d bytes, got %#v", testCases[0].expectedSize, trailer)
+	}
+
+	if packed[0].Type != storage.PreambleType || packed[1].Type != storage.SegmentType {
+		t.Fatalf("expected a preamble and a header segment first, got %#v", packed[:2])
+	}
+
+	// without the preamble announcing it, the stream is not digested
+	unannounced := bytes.NewBuffer(nil)
+	sp := storage.NewJSONPacker(unannounced)
+	for _, e := range packed[1:] {
+		if _, err := sp.AddEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteOutputTarStream(fgp, storage.NewJSONUnpacker(unannounced), io.Discard); err == nil || !strings.Contains(err.Error(), "not announced") {
+		t.Errorf("expected an unannounced trailer to fail, got %v", err)
+	}
+
+	// tamper with the trailer, and with a header byte
+	for i, mangle := range []func(entries []storage.Entry){
+		func(entries []storage.Entry) { entries[len(entries)-1].Size++ },
+		func(entries []storage.Entry) { entries[1].Payload[0] ^= 1 },
+	} {
+		entries := make([]storage.Entry, len(packed))
+		for j, e := range packed {
+			e.Payload = append([]byte(nil), e.Payload...)
+			entries[j] = e
+		}
+		mangle(entries)
+		mangled := bytes.NewBuffer(nil)
+		sp := storage.NewJSONPacker(mangled)
+		for _, e := range entries {
+			if _, err := sp.AddEntry(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := WriteOutputTarStream(fgp, storage.NewJSONUnpacker(mangled), io.Discard)
+		var tme *TrailerMismatchError
+		if !errors.As(err, &tme) {
+			t.Errorf("%d: expected a TrailerMismatchError, got %v", i, err)
+		}
+	}
+}
+
+func TestTarStreamSigned(t *testing.T) {
+	fh, err := os.Open(testCases[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	gzRdr, err := gzip.NewReader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gzRdr.Close()
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := bytes.NewBuffer([]byte{})
+	fgp := storage.NewBufferFileGetPutter()
+	sp := storage.NewSigningPacker(storage.NewJSONPacker(w), key)
+	tarStream, err := NewInputTarStream(gzRdr, sp, fgp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, tarStream); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sp.Sign(); err != nil {
+		t.Fatal(err)
+	}
+	metadata := w.Bytes()
+
+	h := sha1.New()
+	if err := WriteVerifiedOutputTarStream(fgp, storage.NewJSONUnpacker(bytes.NewReader(metadata)), pub, nil, h); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%x", h.Sum(nil)) != testCases[0].expectedSHA1Sum {
+		t.Errorf("checksum of signed assembly does not match: %x", h.Sum(nil))
+	}
+	// a signed stream still assembles without verification
+	h.Reset()
+	if err := WriteOutputTarStream(fgp, storage.NewJSONUnpacker(bytes.NewReader(metadata)), h); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%x", h.Sum(nil)) != testCases[0].expectedSHA1Sum {
+		t.Errorf("checksum of unverified assembly does not match: %x", h.Sum(nil))
+	}
+
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = WriteVerifiedOutputTarStream(fgp, storage.NewJSONUnpacker(bytes.NewReader(metadata)), otherPub, nil, &out)
+	if !errors.Is(err, storage.ErrBadSignature) {
+		t.Errorf("expected %v, got %v", storage.ErrBadSignature, err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected nothing assembled before verification, got %d bytes", out.Len())
+	}
+
+	if err := WriteVerifiedOutputTarStream(nil, storage.NewJSONUnpacker(bytes.NewReader(metadata)), pub, nil, &out); err == nil {
+		t.Error("expected an error without a FileGetter")
+	}
+	if err := WriteVerifiedOutputTarStream(fgp, nil, pub, nil, &out); err == nil {
+		t.Error("expected an error without an Unpacker")
+	}
+}
+
+func TestTarStreamZeroRuns(t *testing.T) {
+	for _, tc := range testCases {
+		fh, err := os.Open(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fh.Close()
+		gzRdr, err := gzip.NewReader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gzRdr.Close()
+
+		compact := bytes.NewBuffer([]byte{})
+		sp := storage.NewZeroRunPacker(storage.NewJSONPacker(compact))
+		fgp := storage.NewBufferFileGetPutter()
+		tarStream, err := NewInputTarStream(gzRdr, sp, fgp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, tarStream); err != nil {
+			t.Fatal(err)
+		}
+
+		h := sha1.New()
+		if err := WriteOutputTarStream(fgp, storage.NewJSONUnpacker(compact), h); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%x", h.Sum(nil)) != tc.expectedSHA1Sum {
+			t.Errorf("%s: checksum of output tar: expected %s; got %x", tc.path, tc.expectedSHA1Sum, h.Sum(nil))
+		}
+	}
+}
+
+func TestTarStreamZeroRunPadding(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, name := range []string{"a", "b"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: 3, Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte("foo")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	compact := bytes.NewBuffer(nil)
+	fgp := storage.NewBufferFileGetPutter()
+	tarStream, err := NewInputTarStream(bytes.NewReader(archive.Bytes()), storage.NewZeroRunPacker(storage.NewJSONPacker(compact)), fgp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, tarStream); err != nil {
+		t.Fatal(err)
+	}
+
+	// read the entries as packed, with the zero runs, into memory
+	var packed []storage.Entry
+	dec := json.NewDecoder(compact)
+	for {
+		var e storage.Entry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		packed = append(packed, e)
+	}
+	var padding int
+	for _, e := range packed {
+		if e.Type == storage.ZeroSegmentType && e.Kind == storage.PaddingSegment {
+			padding++
+		}
+	}
+	if padding != 2 {
+		t.Errorf("expected the padding of both files packed as zero runs, got %d", padding)
+	}
+
+	var out bytes.Buffer
+	if err := WriteOutputTarStream(fgp, storage.NewEntriesUnpacker(packed), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), archive.Bytes()) {
+		t.Errorf("expected the archive reassembled from the zero runs")
+	}
+}
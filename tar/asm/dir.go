@@ -0,0 +1,170 @@
+package asm
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/vbatts/tar-split/archive/tar"
+)
+
+// DirOptions are the options of WriteDir.
+type DirOptions struct {
+	// SourceDateEpoch, if not nil, clamps the modification times of the
+	// files to it, see https://reproducible-builds.org/specs/source-date-epoch/
+	SourceDateEpoch *time.Time
+	// Owner, if not nil, overrides the ownership of all the files
+	Owner *Owner
+	// Names records the user and group names of the owners of the files, as
+	// looked up on the host. Otherwise only their numeric IDs are.
+	Names bool
+	// Xattrs are the patterns, see path.Match, of the names of the extended
+	// attributes recorded. If nil, those of DefaultXattrs are.
+	Xattrs []string
+}
+
+// DefaultXattrs are the extended attributes WriteDir records by default: the
+// file capabilities, which executables may not work without. Others, like
+// security labels, depend on the host.
+var DefaultXattrs = []string{"security.capability"}
+
+// Owner of the files of an archive.
+type Owner struct {
+	UID, GID     int
+	Uname, Gname string
+}
+
+// WriteDir writes the tree under the directory root to w, deterministically:
+// the entries are in lexical order, named relative to root, and their access
+// and change times are not recorded, nor are modification times below the
+// second.
+//
+// The headers are made by tar.FileInfoHeader, with the ownership and devices
+// of the files, see DirOptions.Names. On Linux, their extended attributes
+// selected by DirOptions.Xattrs are recorded. On Unix systems, the files with
+// the same inode after the first are written as hardlinks to it. Sockets are
+// skipped, as they cannot be archived.
+func WriteDir(w *Writer, root string, opts DirOptions) error {
+	xattrs := opts.Xattrs
+	if xattrs == nil {
+		xattrs = DefaultXattrs
+	}
+	links := map[inode]string{}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		if d.Type()&fs.ModeSocket != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var target string
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if target, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := fileInfoHeader(fi, target, opts.Names)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		hdr.Name = name
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if ino, ok := fileInode(fi); ok && fi.Mode().IsRegular() {
+			if first, ok := links[ino]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+			} else {
+				links[ino] = name
+			}
+		}
+		if err := setXattrs(hdr, p, xattrs); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+		hdr.ModTime = hdr.ModTime.Truncate(time.Second)
+		if opts.SourceDateEpoch != nil && hdr.ModTime.After(*opts.SourceDateEpoch) {
+			hdr.ModTime = *opts.SourceDateEpoch
+		}
+		if opts.Owner != nil {
+			hdr.Uid, hdr.Gid = opts.Owner.UID, opts.Owner.GID
+			hdr.Uname, hdr.Gname = opts.Owner.Uname, opts.Owner.Gname
+		}
+
+		if err := w.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size == 0 {
+			return nil
+		}
+		fh, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		_, err = io.CopyN(w, fh, hdr.Size)
+		return err
+	})
+}
+
+// fileInfoHeader is tar.FileInfoHeader, only looking up the names of the
+// owners if names is set.
+func fileInfoHeader(fi fs.FileInfo, target string, names bool) (*tar.Header, error) {
+	if names {
+		return tar.FileInfoHeader(fi, target)
+	}
+	st := statHeader(fi)
+	hdr, err := tar.FileInfoHeader(statInfo{FileInfo: fi, sys: st}, target)
+	if err != nil || st == nil {
+		return hdr, err
+	}
+	if hdr.Typeflag == tar.TypeChar || hdr.Typeflag == tar.TypeBlock {
+		hdr.Devmajor, hdr.Devminor = st.Devmajor, st.Devminor
+	}
+	return hdr, nil
+}
+
+// statInfo is a FileInfo with a tar.Header of its ownership for Sys, which
+// tar.FileInfoHeader takes as it is, rather than looking up the owners.
+type statInfo struct {
+	fs.FileInfo
+	sys *tar.Header
+}
+
+func (si statInfo) Sys() interface{} {
+	if si.sys == nil {
+		return nil
+	}
+	return si.sys
+}
+
+// matchXattr reports whether the extended attribute name matches any of the
+// patterns.
+func matchXattr(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
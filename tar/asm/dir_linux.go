@@ -0,0 +1,82 @@
+package asm
+
+import (
+	"bytes"
+	"sort"
+	"syscall"
+
+	"github.com/vbatts/tar-split/archive/tar"
+)
+
+// setXattrs records the extended attributes of the file p matching the
+// patterns in hdr, as SCHILY.xattr PAX records. Those of symbolic links are
+// not, as reading them would follow the link.
+func setXattrs(hdr *tar.Header, p string, patterns []string) error {
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	names, err := listXattrs(p)
+	if err != nil || len(names) == 0 {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !matchXattr(name, patterns) {
+			continue
+		}
+		value, err := getXattr(p, name)
+		if err != nil {
+			return err
+		}
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = map[string]string{}
+		}
+		hdr.PAXRecords["SCHILY.xattr."+name] = string(value)
+	}
+	return nil
+}
+
+func listXattrs(p string) ([]string, error) {
+	for {
+		size, err := syscall.Listxattr(p, nil)
+		if err == syscall.ENOTSUP {
+			return nil, nil
+		}
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		size, err = syscall.Listxattr(p, buf)
+		if err == syscall.ERANGE {
+			continue // it grew in the meantime
+		}
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, name := range bytes.Split(buf[:size], []byte{0}) {
+			if len(name) > 0 {
+				names = append(names, string(name))
+			}
+		}
+		return names, nil
+	}
+}
+
+func getXattr(p, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(p, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		size, err = syscall.Getxattr(p, name, buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	}
+}
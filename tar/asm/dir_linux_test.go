@@ -0,0 +1,29 @@
+package asm
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDirXattrs(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "file")
+	require.NoError(t, os.WriteFile(p, nil, 0o644))
+	if err := syscall.Setxattr(p, "user.test", []byte("value"), 0); err != nil {
+		t.Skipf("setting user xattrs is not supported: %v", err)
+	}
+
+	// only the allowed extended attributes are recorded
+	hdrs := writeDirHeaders(t, root, DirOptions{})
+	require.Len(t, hdrs, 1)
+	assert.NotContains(t, hdrs[0].PAXRecords, "SCHILY.xattr.user.test")
+
+	hdrs = writeDirHeaders(t, root, DirOptions{Xattrs: []string{"user.*"}})
+	require.Len(t, hdrs, 1)
+	assert.Equal(t, "value", hdrs[0].PAXRecords["SCHILY.xattr.user.test"])
+}
@@ -0,0 +1,16 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package asm
+
+import (
+	"io/fs"
+
+	"github.com/vbatts/tar-split/archive/tar"
+)
+
+type inode struct{}
+
+func fileInode(fi fs.FileInfo) (inode, bool) { return inode{}, false }
+
+func statHeader(fi fs.FileInfo) *tar.Header { return nil }
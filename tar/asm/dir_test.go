@@ -0,0 +1,110 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func TestWriteDir(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "b/c"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "b/c/file"), []byte("hello"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a"), nil, 0o600))
+	require.NoError(t, os.Link(filepath.Join(root, "b/c/file"), filepath.Join(root, "b/link")))
+	require.NoError(t, os.Symlink("c/file", filepath.Join(root, "b/symlink")))
+	future := time.Now().Add(24 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "a"), future, future))
+
+	epoch := time.Unix(1500000000, 0)
+	opts := DirOptions{
+		SourceDateEpoch: &epoch,
+		Owner:           &Owner{UID: 0, GID: 0, Uname: "root", Gname: "root"},
+	}
+	write := func() ([]byte, []byte, storage.FileGetPutter) {
+		var archive, metadata bytes.Buffer
+		fgp := storage.NewBufferFileGetPutter()
+		w, err := NewWriter(&archive, storage.NewJSONPacker(&metadata), fgp)
+		require.NoError(t, err)
+		require.NoError(t, WriteDir(w, root, opts))
+		require.NoError(t, w.Close())
+		return archive.Bytes(), metadata.Bytes(), fgp
+	}
+	archive, metadata, fgp := write()
+
+	// the same again, after the access times changed
+	_, err := os.ReadFile(filepath.Join(root, "b/c/file"))
+	require.NoError(t, err)
+	archive2, _, _ := write()
+	assert.Equal(t, archive, archive2)
+
+	var assembled bytes.Buffer
+	require.NoError(t, WriteOutputTarStream(fgp, storage.NewJSONUnpacker(bytes.NewReader(metadata)), &assembled))
+	assert.Equal(t, archive, assembled.Bytes())
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		assert.False(t, hdr.ModTime.After(epoch), hdr.Name)
+		assert.Equal(t, "root", hdr.Uname, hdr.Name)
+		switch hdr.Name {
+		case "b/link":
+			if runtime.GOOS != "windows" {
+				assert.Equal(t, byte(tar.TypeLink), hdr.Typeflag)
+				assert.Equal(t, "b/c/file", hdr.Linkname)
+			}
+		case "b/symlink":
+			assert.Equal(t, byte(tar.TypeSymlink), hdr.Typeflag)
+			assert.Equal(t, "c/file", hdr.Linkname)
+		}
+	}
+	assert.Equal(t, []string{"a", "b/", "b/c/", "b/c/file", "b/link", "b/symlink"}, names)
+
+	// without an owner, only the numeric IDs are recorded by default
+	for _, names := range []bool{false, true} {
+		hdrs := writeDirHeaders(t, root, DirOptions{Names: names})
+		require.NotEmpty(t, hdrs)
+		if runtime.GOOS != "windows" {
+			assert.Equal(t, os.Getuid(), hdrs[0].Uid)
+		}
+		if !names {
+			assert.Empty(t, hdrs[0].Uname)
+			assert.Empty(t, hdrs[0].Gname)
+		}
+	}
+}
+
+// writeDirHeaders returns the headers of the archive WriteDir writes of root.
+func writeDirHeaders(t *testing.T, root string, opts DirOptions) []*tar.Header {
+	var archive bytes.Buffer
+	w, err := NewWriter(&archive, storage.NewJSONPacker(io.Discard), nil)
+	require.NoError(t, err)
+	require.NoError(t, WriteDir(w, root, opts))
+	require.NoError(t, w.Close())
+
+	var hdrs []*tar.Header
+	tr := tar.NewReader(&archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return hdrs
+		}
+		require.NoError(t, err)
+		hdrs = append(hdrs, hdr)
+	}
+}
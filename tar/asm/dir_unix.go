@@ -0,0 +1,39 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package asm
+
+import (
+	"io/fs"
+	"syscall"
+
+	"github.com/vbatts/tar-split/archive/tar"
+	"golang.org/x/sys/unix"
+)
+
+type inode struct {
+	dev, ino uint64
+}
+
+func fileInode(fi fs.FileInfo) (inode, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return inode{}, false
+	}
+	return inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// statHeader returns a tar.Header with the numeric IDs of the owners of the
+// file, and its device numbers, or nil if they are unknown.
+func statHeader(fi fs.FileInfo) *tar.Header {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	hdr := &tar.Header{Uid: int(st.Uid), Gid: int(st.Gid)}
+	if fi.Mode()&fs.ModeDevice != 0 {
+		rdev := uint64(st.Rdev) // may be signed
+		hdr.Devmajor, hdr.Devminor = int64(unix.Major(rdev)), int64(unix.Minor(rdev))
+	}
+	return hdr
+}
@@ -2,6 +2,7 @@ package asm
 
 import (
 	"io"
+	"strconv"
 
 	"github.com/vbatts/tar-split/archive/tar"
 	"github.com/vbatts/tar-split/tar/storage"
@@ -18,6 +19,100 @@ import (
 // storage.FilePutter. Since the checksumming is still needed, then a default
 // of NewDiscardFilePutter will be used internally
 func NewInputTarStream(r io.Reader, p storage.Packer, fp storage.FilePutter) (io.Reader, error) {
+	return NewInputTarStreamWithOptions(r, p, fp, InputOptions{})
+}
+
+// InputOptions are the options of NewInputTarStreamWithOptions.
+type InputOptions struct {
+	// SegmentKinds packs the padding of each file, its headers, the
+	// end-of-archive marker and the rest of the stream in separate
+	// storage.SegmentType entries, with their storage.SegmentKind recorded.
+	// Otherwise, the padding of a file is packed with the following header.
+	// Packing to a storage.NewZeroRunPacker implies it, as only segments of
+	// zero bytes alone are compacted, and so does Salvage.
+	SegmentKinds bool
+	// IgnoreZeros reads on past the end-of-archive markers, through archives
+	// concatenated together like by tar --concatenate, see
+	// tar.Reader.IgnoreZeros. The zero blocks before a header are packed in
+	// their own storage.SegmentType entry, of storage.EndSegment kind, so the
+	// metadata of the later files is kept. This has no effect on a Writer.
+	IgnoreZeros bool
+	// Salvage, if not nil, makes damage to the archive, like a header with a
+	// bad checksum or a payload cut short, not an error: the bytes from the
+	// damage on are packed as they are, in storage.TrailingSegment segments
+	// that IterateHeaders skips, and Salvage is filled in with where and why.
+	// It implies SegmentKinds, and is only complete once the stream is read
+	// to the end. This has no effect on a Writer.
+	Salvage *SalvageReport
+	// Leniency accepts headers that deviate from the tar format, as some
+	// legacy producers write them, see tar.Reader.Leniency. They are packed as
+	// they are, and IterateHeaders reports how they deviate. More leniency
+	// than tar.Diagnose implies Preamble, which records it for the consumers
+	// to read the headers with. This has no effect on a Writer.
+	Leniency tar.Leniency
+	// Preamble packs a storage.PreambleType entry first, recording the
+	// version of the metadata format, the Producer, and the options the
+	// metadata is packed with. Consumers predating the entry types that can
+	// be skipped fail on such metadata.
+	Preamble bool
+	// Producer identifies the program producing the metadata, and its
+	// version, in the preamble. It defaults to storage.DefaultProducer.
+	Producer string
+	// Trailer packs a storage.TrailerType entry last, recording the size and
+	// digest of the whole archive, for WriteOutputTarStream to verify the
+	// reassembled one. It implies Preamble, which announces the trailer so
+	// the archive is only digested when there is one.
+	Trailer bool
+}
+
+// packPreamble packs the storage.PreambleType entry to p, if opts ask for it.
+func packPreamble(p storage.Packer, opts InputOptions) error {
+	if !opts.Preamble && !opts.Trailer && opts.Leniency <= tar.Diagnose {
+		return nil
+	}
+	pre := storage.NewPreamble()
+	if opts.Producer != "" {
+		pre.Producer = opts.Producer
+	}
+	if opts.Trailer {
+		pre.DigestAlgorithm = storage.DigestAlgorithm
+	}
+	pre.Options = storage.PackerOptions(p)
+	if opts.SegmentKinds {
+		pre.Options["segment_kinds"] = "true"
+	}
+	if opts.IgnoreZeros {
+		pre.Options["ignore_zeros"] = "true"
+	}
+	if opts.Salvage != nil {
+		pre.Options["salvage"] = "true"
+	}
+	if opts.Leniency != tar.Strict {
+		pre.Options["leniency"] = strconv.Itoa(int(opts.Leniency))
+	}
+	if len(pre.Options) == 0 {
+		pre.Options = nil
+	}
+	entry, err := pre.Entry()
+	if err != nil {
+		return err
+	}
+	_, err = p.AddEntry(entry)
+	return err
+}
+
+// forPacker returns the options implied by packing to p.
+func (opts InputOptions) forPacker(p storage.Packer) InputOptions {
+	if storage.PackerOptions(p)["zero_runs"] != "" || opts.Salvage != nil {
+		opts.SegmentKinds = true
+	}
+	return opts
+}
+
+// NewInputTarStreamWithOptions is NewInputTarStream, with options.
+func NewInputTarStreamWithOptions(r io.Reader, p storage.Packer, fp storage.FilePutter, opts InputOptions) (io.Reader, error) {
+	opts = opts.forPacker(p)
+
 	// What to do here... folks will want their own access to the Reader that is
 	// their tar archive stream, but we'll need that same stream to use our
 	// forked 'archive/tar'.
@@ -35,34 +130,89 @@ func NewInputTarStream(r io.Reader, p storage.Packer, fp storage.FilePutter) (io
 	// the end, we want to be the one reading the padding, even if the user's
 	// `archive/tar` doesn't care.
 	pR, pW := io.Pipe()
-	outputRdr := io.TeeReader(r, pW)
+	var digester *streamDigester
+	var tee io.Writer = pW
+	if opts.Trailer {
+		digester = newStreamDigester()
+		tee = io.MultiWriter(digester, pW)
+	}
+	outputRdr := io.TeeReader(r, tee)
 
 	// we need a putter that will generate the crc64 sums of file payloads
 	if fp == nil {
 		fp = storage.NewDiscardFilePutter()
 	}
 
+	if err := packPreamble(p, opts); err != nil {
+		return nil, err
+	}
+
 	go func() {
-		tr := tar.NewReader(outputRdr)
+		// when salvaging, the raw bytes of a failed header are kept by the tap
+		tap := &salvageTap{r: outputRdr}
+		tr := tar.NewReader(tap)
 		tr.RawAccounting = true
+		tr.IgnoreZeros = opts.IgnoreZeros
+		tr.Leniency = opts.Leniency
+		// addSegment packs the raw bytes read since the last call. With
+		// segment kinds, the padding of the previous file is split off.
+		var padding int64
+		addSegment := func(kind storage.SegmentKind) error {
+			b := tr.RawBytes()
+			n := padding
+			if n > int64(len(b)) {
+				n = int64(len(b))
+			}
+			if opts.SegmentKinds && n > 0 {
+				if err := addRawSegment(p, storage.PaddingSegment, b[:n]); err != nil {
+					return err
+				}
+				b = b[n:]
+				n = 0
+			}
+			padding = 0
+			if opts.IgnoreZeros && kind == storage.HeaderSegment {
+				// the end of an archive concatenated with this one
+				if z := n + zeroBlocks(b[n:]); z > n {
+					endKind := storage.EndSegment
+					if !opts.SegmentKinds {
+						endKind = ""
+					}
+					if err := addRawSegment(p, endKind, b[:z]); err != nil {
+						return err
+					}
+					b = b[z:]
+				}
+			}
+			if !opts.SegmentKinds {
+				kind = ""
+			}
+			return addRawSegment(p, kind, b)
+		}
+		var lastGood string
 		for {
+			tap.record(opts.Salvage != nil)
+			headerOffset := tap.n + padding
 			hdr, err := tr.Next()
+			tap.record(false)
 			if err != nil {
 				if err != io.EOF {
-					pW.CloseWithError(err)
-					return
-				}
-				// even when an EOF is reached, there is often 1024 null bytes on
-				// the end of an archive. Collect them too.
-				if b := tr.RawBytes(); len(b) > 0 {
-					_, err := p.AddEntry(storage.Entry{
-						Type:    storage.SegmentType,
-						Payload: b,
-					})
-					if err != nil {
+					if opts.Salvage == nil {
 						pW.CloseWithError(err)
 						return
 					}
+					*opts.Salvage = SalvageReport{Err: err, Offset: headerOffset, LastGood: lastGood}
+					if err := salvageSegments(p, opts, padding, tap.buf.Bytes()); err != nil {
+						pW.CloseWithError(err)
+						return
+					}
+					break // the rest is packed as it is
+				}
+				// even when an EOF is reached, there is often 1024 null bytes on
+				// the end of an archive. Collect them too.
+				if err := addSegment(storage.EndSegment); err != nil {
+					pW.CloseWithError(err)
+					return
 				}
 				break // not return. We need the end of the reader.
 			}
@@ -70,21 +220,23 @@ func NewInputTarStream(r io.Reader, p storage.Packer, fp storage.FilePutter) (io
 				break // not return. We need the end of the reader.
 			}
 
-			if b := tr.RawBytes(); len(b) > 0 {
-				_, err := p.AddEntry(storage.Entry{
-					Type:    storage.SegmentType,
-					Payload: b,
-				})
-				if err != nil {
-					pW.CloseWithError(err)
-					return
-				}
+			if err := addSegment(storage.HeaderSegment); err != nil {
+				pW.CloseWithError(err)
+				return
 			}
 
 			var csum []byte
+			size := hdr.Size
+			var truncated error
 			if hdr.Size > 0 {
 				var err error
-				_, csum, err = fp.Put(hdr.Name, tr)
+				if opts.Salvage == nil {
+					_, csum, err = fp.Put(hdr.Name, tr)
+				} else {
+					payload := &salvagePayload{r: tr}
+					size, csum, err = fp.Put(hdr.Name, payload)
+					truncated = payload.err
+				}
 				if err != nil {
 					pW.CloseWithError(err)
 					return
@@ -93,29 +245,29 @@ func NewInputTarStream(r io.Reader, p storage.Packer, fp storage.FilePutter) (io
 
 			entry := storage.Entry{
 				Type:    storage.FileType,
-				Size:    hdr.Size,
+				Size:    size,
 				Payload: csum,
 			}
 			// For proper marshalling of non-utf8 characters
 			entry.SetName(hdr.Name)
 
 			// File entries added, regardless of size
-			_, err = p.AddEntry(entry)
+			pos, err := p.AddEntry(entry)
 			if err != nil {
 				pW.CloseWithError(err)
 				return
 			}
+			if truncated != nil {
+				*opts.Salvage = SalvageReport{Err: truncated, Offset: tap.n, Position: pos, LastGood: lastGood, Truncated: hdr.Name}
+				break // the rest is packed as it is
+			}
+			lastGood = hdr.Name
 
-			if b := tr.RawBytes(); len(b) > 0 {
-				_, err = p.AddEntry(storage.Entry{
-					Type:    storage.SegmentType,
-					Payload: b,
-				})
-				if err != nil {
-					pW.CloseWithError(err)
-					return
-				}
+			if err := addSegment(storage.PaddingSegment); err != nil {
+				pW.CloseWithError(err)
+				return
 			}
+			padding = tr.ExpectedPadding()
 		}
 
 		// It is allowable, and not uncommon that there is further padding on
@@ -136,11 +288,11 @@ func NewInputTarStream(r io.Reader, p storage.Packer, fp storage.FilePutter) (io
 				isEOF = true
 			}
 			if n != 0 {
-				_, err = p.AddEntry(storage.Entry{
-					Type:    storage.SegmentType,
-					Payload: paddingChunk[:n],
-				})
-				if err != nil {
+				kind := storage.TrailingSegment
+				if !opts.SegmentKinds {
+					kind = ""
+				}
+				if err := addRawSegment(p, kind, paddingChunk[:n]); err != nil {
 					pW.CloseWithError(err)
 					return
 				}
@@ -149,8 +301,74 @@ func NewInputTarStream(r io.Reader, p storage.Packer, fp storage.FilePutter) (io
 				break
 			}
 		}
+
+		if digester != nil {
+			if _, err := p.AddEntry(digester.Entry()); err != nil {
+				pW.CloseWithError(err)
+				return
+			}
+		}
 		pW.Close()
 	}()
 
 	return pR, nil
 }
+
+// salvageSegments packs the bytes of a header that failed to be read, after
+// the padding of the previous file, and records their position in the
+// report.
+func salvageSegments(p storage.Packer, opts InputOptions, padding int64, b []byte) error {
+	// the Packer may keep the payload
+	b = append([]byte(nil), b...)
+	if opts.SegmentKinds && padding > 0 && int64(len(b)) >= padding {
+		if err := addRawSegment(p, storage.PaddingSegment, b[:padding]); err != nil {
+			return err
+		}
+		b = b[padding:]
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	kind := storage.TrailingSegment
+	if !opts.SegmentKinds {
+		kind = ""
+	}
+	pos, err := p.AddEntry(storage.Entry{
+		Type:    storage.SegmentType,
+		Payload: b,
+		Kind:    kind,
+	})
+	opts.Salvage.Position = pos
+	return err
+}
+
+// addRawSegment packs b as a storage.SegmentType entry, unless it is empty.
+func addRawSegment(p storage.Packer, kind storage.SegmentKind, b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	_, err := p.AddEntry(storage.Entry{
+		Type:    storage.SegmentType,
+		Payload: b,
+		Kind:    kind,
+	})
+	return err
+}
+
+// zeroBlocks returns the length of the zero blocks b starts with.
+func zeroBlocks(b []byte) int64 {
+	var n int64
+	for int64(len(b)) >= n+blockSize && isZeroBlock(b[n:n+blockSize]) {
+		n += blockSize
+	}
+	return n
+}
+
+func isZeroBlock(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -2,11 +2,17 @@ package asm
 
 import (
 	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
 	"fmt"
 	"io"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
+	forktar "github.com/vbatts/tar-split/archive/tar"
 	"github.com/vbatts/tar-split/tar/storage"
 )
 
@@ -66,3 +72,316 @@ func TestLargeJunkPadding(t *testing.T) {
 	// At this point, if we haven't crashed then we are not vulnerable to
 	// CVE-2017-14992.
 }
+
+func disassembleTestCase(t *testing.T, path string, opts InputOptions) ([]byte, storage.FileGetPutter) {
+	t.Helper()
+	fh, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	gzRdr, err := gzip.NewReader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gzRdr.Close()
+
+	w := bytes.NewBuffer([]byte{})
+	fgp := storage.NewBufferFileGetPutter()
+	tarStream, err := NewInputTarStreamWithOptions(gzRdr, storage.NewJSONPacker(w), fgp, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, tarStream); err != nil {
+		t.Fatal(err)
+	}
+	return w.Bytes(), fgp
+}
+
+func TestSegmentKinds(t *testing.T) {
+	for _, tc := range testCases {
+		legacy, _ := disassembleTestCase(t, tc.path, InputOptions{})
+		kinds, fgp := disassembleTestCase(t, tc.path, InputOptions{SegmentKinds: true})
+
+		h := sha1.New()
+		if err := WriteOutputTarStream(fgp, storage.NewJSONUnpacker(bytes.NewReader(kinds)), h); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%x", h.Sum(nil)) != tc.expectedSHA1Sum {
+			t.Errorf("%s: checksum of output tar: expected %s; got %x", tc.path, tc.expectedSHA1Sum, h.Sum(nil))
+		}
+
+		// every segment has a kind, and headers are whole
+		jup := storage.NewJSONUnpacker(bytes.NewReader(kinds))
+		for {
+			e, err := jup.Next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				t.Fatal(err)
+			}
+			if e.Type != storage.SegmentType {
+				continue
+			}
+			switch e.Kind {
+			case storage.HeaderSegment:
+				if len(e.Payload)%512 != 0 {
+					t.Errorf("%s: header segment at %d of %d bytes", tc.path, e.Position, len(e.Payload))
+				}
+			case storage.PaddingSegment:
+				if len(e.Payload) >= 512 {
+					t.Errorf("%s: padding segment at %d of %d bytes", tc.path, e.Position, len(e.Payload))
+				}
+			case storage.EndSegment, storage.TrailingSegment:
+			default:
+				t.Errorf("%s: segment at %d without a kind", tc.path, e.Position)
+			}
+		}
+
+		var legacyHdrs, kindsHdrs []*forktar.Header
+		if err := IterateHeaders(storage.NewJSONUnpacker(bytes.NewReader(legacy)), func(hdr *forktar.Header) error {
+			legacyHdrs = append(legacyHdrs, hdr)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := IterateHeaders(storage.NewJSONUnpacker(bytes.NewReader(kinds)), func(hdr *forktar.Header) error {
+			kindsHdrs = append(kindsHdrs, hdr)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(legacyHdrs, kindsHdrs) {
+			t.Errorf("%s: expected the same headers with segment kinds", tc.path)
+		}
+
+		legacyProblems, err := Check(storage.NewJSONUnpacker(bytes.NewReader(legacy)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		kindsProblems, err := Check(storage.NewJSONUnpacker(bytes.NewReader(kinds)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(legacyProblems) != len(kindsProblems) {
+			t.Errorf("%s: expected the same problems with segment kinds, got %v and %v", tc.path, legacyProblems, kindsProblems)
+		}
+	}
+}
+
+func TestIgnoreZeros(t *testing.T) {
+	// two archives concatenated, like by tar --concatenate
+	var concatenated bytes.Buffer
+	for _, name := range []string{"first", "second"} {
+		tw := forktar.NewWriter(&concatenated)
+		if err := tw.WriteHeader(&forktar.Header{Name: name, Mode: 0o644, Size: 3}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name[:3])); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, opts := range []InputOptions{{IgnoreZeros: true}, {IgnoreZeros: true, SegmentKinds: true}} {
+		var metadata bytes.Buffer
+		fgp := storage.NewBufferFileGetPutter()
+		its, err := NewInputTarStreamWithOptions(bytes.NewReader(concatenated.Bytes()), storage.NewJSONPacker(&metadata), fgp, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, its); err != nil {
+			t.Fatal(err)
+		}
+
+		var assembled bytes.Buffer
+		if err := WriteOutputTarStream(fgp, storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes())), &assembled); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(assembled.Bytes(), concatenated.Bytes()) {
+			t.Errorf("%+v: reassembled archive differs", opts)
+		}
+
+		var names []string
+		if err := IterateHeaders(storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes())), func(hdr *forktar.Header) error {
+			names = append(names, hdr.Name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names, []string{"first", "second"}) {
+			t.Errorf("%+v: headers %q", opts, names)
+		}
+
+		problems, err := Check(storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes())))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(problems) > 0 {
+			t.Errorf("%+v: problems %v", opts, problems)
+		}
+
+		var replaced, newMetadata bytes.Buffer
+		replacements := map[string][]byte{"second": []byte("2nd")}
+		if err := ReplacePayloads(fgp, storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes())), replacements, &replaced, storage.NewJSONPacker(&newMetadata)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(replaced.Bytes(), bytes.Replace(concatenated.Bytes(), []byte("sec\x00"), []byte("2nd\x00"), 1)) {
+			t.Errorf("%+v: archive with a replaced payload differs", opts)
+		}
+	}
+}
+
+func TestLeniency(t *testing.T) {
+	var buf bytes.Buffer
+	tw := forktar.NewWriter(&buf)
+	for _, name := range []string{"first", "second"} {
+		if err := tw.WriteHeader(&forktar.Header{Name: name, Mode: 0o644, Size: 3, Format: forktar.FormatUSTAR}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name[:3])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+	// junk in the uid of the first header, which is then checksummed again,
+	// and a wrong checksum for the second one
+	first, second := archive[:512], archive[1024:1536]
+	copy(first[108:116], "00017x9\x00")
+	copy(first[148:156], "        ")
+	var sum int64
+	for _, c := range first {
+		sum += int64(c)
+	}
+	copy(first[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	copy(second[148:156], "000001\x00 ")
+
+	var metadata bytes.Buffer
+	its, err := NewInputTarStreamWithOptions(bytes.NewReader(archive), storage.NewJSONPacker(&metadata), nil, InputOptions{})
+	if err == nil {
+		_, err = io.Copy(io.Discard, its)
+	}
+	if err == nil {
+		t.Fatal("expected a strict disassembly to fail")
+	}
+
+	metadata.Reset()
+	fgp := storage.NewBufferFileGetPutter()
+	its, err = NewInputTarStreamWithOptions(bytes.NewReader(archive), storage.NewJSONPacker(&metadata), fgp, InputOptions{Leniency: forktar.LenientChecksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, its); err != nil {
+		t.Fatal(err)
+	}
+	var assembled bytes.Buffer
+	if err := WriteOutputTarStream(fgp, storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes())), &assembled); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(assembled.Bytes(), archive) {
+		t.Error("reassembled archive differs")
+	}
+
+	var diags []string
+	if err := IterateHeaders(storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes())), func(hdr *forktar.Header) error {
+		for _, d := range hdr.Diagnostics {
+			diags = append(diags, hdr.Name+" "+d.String())
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`first uid: invalid octal number "00017x9" read as 15`,
+		"second chksum: checksum 1 should be ",
+	}
+	if len(diags) != 2 || diags[0] != want[0] || !strings.HasPrefix(diags[1], want[1]) {
+		t.Errorf("diagnostics %q, want %q", diags, want)
+	}
+
+	// the leniency is taken from the preamble, without which the bad
+	// checksum is an error
+	unpacker := storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes()))
+	if entry, err := unpacker.Next(); err != nil || entry.Type != storage.PreambleType {
+		t.Fatalf("expected a preamble, got %v, %v", entry, err)
+	}
+	if err := IterateHeaders(unpacker, func(hdr *forktar.Header) error { return nil }); err == nil {
+		t.Error("expected the headers to be read with tar.Diagnose without a preamble")
+	}
+
+	problems, err := Check(storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Position != 3 {
+		t.Errorf("problems %v, want one for the checksum of the second header", problems)
+	}
+}
+
+func TestPreambleOptions(t *testing.T) {
+	var archive bytes.Buffer
+	tw := forktar.NewWriter(&archive)
+	if err := tw.WriteHeader(&forktar.Header{Name: "file", Mode: 0o644}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	firstEntry := func(opts InputOptions) *storage.Entry {
+		var metadata bytes.Buffer
+		p := storage.NewZeroRunPacker(storage.NewJSONPackerWithChecksums(&metadata))
+		its, err := NewInputTarStreamWithOptions(bytes.NewReader(archive.Bytes()), p, nil, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, its); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := storage.NewJSONUnpacker(&metadata).Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+
+	if entry := firstEntry(InputOptions{}); entry.Type != storage.SegmentType {
+		t.Errorf("expected no preamble without asking for it, got a %s entry first", entry.Type)
+	}
+
+	entry := firstEntry(InputOptions{
+		Preamble:     true,
+		Producer:     "tar-split test",
+		SegmentKinds: true,
+		IgnoreZeros:  true,
+		Salvage:      &SalvageReport{},
+		Leniency:     forktar.LenientNumeric,
+	})
+	pre, err := storage.DecodePreamble(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pre.Producer != "tar-split test" {
+		t.Errorf("producer %q", pre.Producer)
+	}
+	if pre.DigestAlgorithm != "" {
+		t.Errorf("expected no trailer to be announced, got digest algorithm %q", pre.DigestAlgorithm)
+	}
+	expected := map[string]string{
+		"checksums":     "true",
+		"zero_runs":     "true",
+		"segment_kinds": "true",
+		"ignore_zeros":  "true",
+		"salvage":       "true",
+		"leniency":      "2",
+	}
+	if !reflect.DeepEqual(pre.Options, expected) {
+		t.Errorf("options %v, expected %v", pre.Options, expected)
+	}
+}
@@ -0,0 +1,190 @@
+package asm
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// PathFilter selects files by their names, with include and exclude patterns.
+//
+// The patterns are those of path.Match, matched against each element of the
+// names, with "**" matching any number of elements. Leading slashes and "./"
+// are ignored, in the patterns and the names, so "/etc/**" selects "etc/",
+// "./etc/passwd" and "etc/ssl/certs/".
+type PathFilter struct {
+	include, exclude [][]string
+}
+
+// NewPathFilter returns a PathFilter selecting the files matching any of the
+// include patterns, or all the files if there are none, unless they match one
+// of the exclude patterns.
+func NewPathFilter(include, exclude []string) (*PathFilter, error) {
+	f := &PathFilter{}
+	for _, p := range include {
+		elems, err := splitPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, elems)
+	}
+	for _, p := range exclude {
+		elems, err := splitPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, elems)
+	}
+	return f, nil
+}
+
+func splitPattern(pattern string) ([]string, error) {
+	elems := splitName(pattern)
+	for _, e := range elems {
+		if _, err := path.Match(e, ""); err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+	}
+	return elems, nil
+}
+
+// splitName splits a name of the archive into its elements.
+func splitName(name string) []string {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil
+	}
+	return strings.Split(name[1:], "/")
+}
+
+// Match reports whether the file named name is selected.
+func (f *PathFilter) Match(name string) bool {
+	elems := splitName(name)
+	for _, p := range f.exclude {
+		if matchElems(p, elems) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if matchElems(p, elems) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// droppedFile is a regular file left out by FilterTarStream, which hardlinks
+// may still need.
+type droppedFile struct {
+	hdr   *tar.Header
+	entry *storage.Entry
+}
+
+// FilterTarStream writes the tar archive described by the Unpacker to w, with
+// only the files for which keep returns true, and packs the metadata of the
+// new archive to p, as a Writer with opts would. The payloads of the files
+// left out are not read, and the headers of the files kept are written byte
+// for byte. The archive is ended anew, and the storage.TrailerType entry, if
+// any, describes the new archive.
+//
+// A hardlink kept to a regular file left out becomes a regular file, with the
+// header of its target and the payload, and the next hardlinks kept to the
+// same target link to it instead. PAX global headers are always kept, and
+// keep is not called for them. Archives with sparse files are not supported.
+func FilterTarStream(fg storage.FileGetter, up storage.Unpacker, keep func(hdr *tar.Header) bool, w io.Writer, p storage.Packer, opts InputOptions) error {
+	tw, err := NewWriterWithOptions(w, p, nil, opts)
+	if err != nil {
+		return err
+	}
+	if err := filterEntries(tw, fg, up, keep); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// filterEntries writes the files of the archive described by the Unpacker
+// for which keep returns true to tw, see FilterTarStream.
+func filterEntries(tw *Writer, fg storage.FileGetter, up storage.Unpacker, keep func(hdr *tar.Header) bool) error {
+	dropped := map[string]droppedFile{}
+	moved := map[string]string{} // names whose payload is under another one
+	return iterateEntries(up, func(rec *Record, entry *storage.Entry) error {
+		hdr := rec.Header
+		if entry == nil {
+			return fmt.Errorf("tar header for %q is not followed by a file entry", hdr.Name)
+		}
+		name := path.Clean(hdr.Name)
+		if hdr.Typeflag != tar.TypeXGlobalHeader && !keep(hdr) {
+			switch hdr.Typeflag {
+			case tar.TypeReg, tar.TypeRegA:
+				dropped[name] = droppedFile{hdr: hdr, entry: entry}
+				delete(moved, name)
+			case tar.TypeLink:
+				target := path.Clean(hdr.Linkname)
+				if d, ok := dropped[target]; ok {
+					dropped[name] = d
+				} else if m, ok := moved[target]; ok {
+					moved[name] = m
+				} else {
+					moved[name] = hdr.Linkname
+				}
+			}
+			return nil
+		}
+		delete(dropped, name)
+		delete(moved, name)
+
+		if hdr.Typeflag == tar.TypeLink {
+			target := path.Clean(hdr.Linkname)
+			if d, ok := dropped[target]; ok {
+				newHdr := cloneHeader(d.hdr)
+				newHdr.Name = hdr.Name
+				if err := writeHeaderInFormat(tw, newHdr); err != nil {
+					return fmt.Errorf("%s: %w", hdr.Name, err)
+				}
+				delete(dropped, target)
+				moved[target] = hdr.Name
+				return copyPayload(tw, fg, d.entry)
+			}
+			if m, ok := moved[target]; ok {
+				newHdr := cloneHeader(hdr)
+				newHdr.Linkname = m
+				if err := writeHeaderInFormat(tw, newHdr); err != nil {
+					return fmt.Errorf("%s: %w", hdr.Name, err)
+				}
+				return nil
+			}
+		}
+		if err := tw.WriteRawHeader(rec.RawHeader, hdr); err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		return copyPayload(tw, fg, entry)
+	})
+}
@@ -0,0 +1,80 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func TestPathFilter(t *testing.T) {
+	f, err := NewPathFilter([]string{"/etc/**", "usr/bin/*sh"}, []string{"etc/ssl/**", "**/*.bak"})
+	require.NoError(t, err)
+	for name, expected := range map[string]bool{
+		"etc/":                  true,
+		"./etc/passwd":          true,
+		"/etc/ssl":              false,
+		"etc/ssl/certs/ca.pem":  false,
+		"etc/passwd.bak":        false,
+		"etc/deep/dir/file":     true,
+		"usr/bin/bash":          true,
+		"usr/bin/bash/complete": false,
+		"usr/":                  false,
+		"etcetera":              false,
+	} {
+		assert.Equal(t, expected, f.Match(name), name)
+	}
+
+	all, err := NewPathFilter(nil, []string{"tmp"})
+	require.NoError(t, err)
+	assert.True(t, all.Match("anything"))
+	assert.False(t, all.Match("tmp/"))
+
+	_, err = NewPathFilter([]string{"etc/[z-"}, nil)
+	assert.Error(t, err)
+}
+
+func TestFilterTarStream(t *testing.T) {
+	files := []testFile{
+		{tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0o755}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd", Mode: 0o644}, "root:x:0:0"},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "etc/ssl/ca.pem", Mode: 0o644}, "cert"},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "usr/bin/tool", Mode: 0o755}, "binary"},
+		{tar.Header{Typeflag: tar.TypeLink, Name: "etc/tool", Linkname: "usr/bin/tool"}, ""},
+		{tar.Header{Typeflag: tar.TypeLink, Name: "etc/tool2", Linkname: "usr/bin/tool"}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd.link.target", Mode: 0o644}, "x"},
+	}
+	f, err := NewPathFilter([]string{"/etc/**"}, []string{"etc/ssl/**", "**/*.target"})
+	require.NoError(t, err)
+
+	for _, opts := range []InputOptions{{}, {SegmentKinds: true}} {
+		var archive, metadata bytes.Buffer
+		fgp := storage.NewBufferFileGetPutter()
+		writeTestArchive(t, files, &archive, storage.NewJSONPacker(&metadata), fgp, opts)
+
+		var output, newMetadata bytes.Buffer
+		keep := func(hdr *tar.Header) bool { return f.Match(hdr.Name) }
+		require.NoError(t, FilterTarStream(fgp, storage.NewJSONUnpacker(&metadata), keep, &output, storage.NewJSONPacker(&newMetadata), opts))
+
+		// the files kept are as they were, apart from the hardlinks
+		var expected bytes.Buffer
+		writeTestArchive(t, []testFile{
+			files[0],
+			files[1],
+			{tar.Header{Typeflag: tar.TypeReg, Name: "etc/tool", Mode: 0o755}, "binary"},
+			{tar.Header{Typeflag: tar.TypeLink, Name: "etc/tool2", Linkname: "etc/tool"}, ""},
+		}, &expected, storage.NewJSONPacker(io.Discard), nil, opts)
+		assert.Equal(t, expected.Bytes(), output.Bytes(), "%+v", opts)
+
+		// the new metadata reassembles the new archive
+		_, _, err := fgp.Put("etc/tool", bytes.NewReader([]byte("binary")))
+		require.NoError(t, err)
+		var assembled bytes.Buffer
+		require.NoError(t, WriteOutputTarStream(fgp, storage.NewJSONUnpacker(&newMetadata), &assembled))
+		assert.Equal(t, output.Bytes(), assembled.Bytes(), "%+v", opts)
+	}
+}
@@ -0,0 +1,359 @@
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// maxSymlinks is the number of symbolic links followed while resolving a path
+// before giving up.
+const maxSymlinks = 40
+
+// FS is a read-only view of a tar archive, as an io/fs.FS.
+//
+// The directory structure and file information are taken from the tar headers
+// stored in the tar-split metadata, and the file contents are read from a
+// storage.FileGetter, verified against the checksums recorded in the metadata.
+//
+// FS implements fs.ReadDirFS and fs.StatFS. Additionally, ReadLink and Lstat
+// provide access to symbolic links without following them.
+type FS struct {
+	fg    storage.FileGetter
+	nodes map[string]*fsNode
+}
+
+type fsNode struct {
+	name     string // cleaned path of the node, "." for the root
+	hdr      *tar.Header
+	entry    *storage.Entry // the FileType entry of the payload, if any
+	children []string       // sorted base names, only for directories
+}
+
+// NewFS reads all the entries provided by the Unpacker and returns a FS
+// serving the files' payloads from the FileGetter.
+//
+// Directories that are not present in the archive, but are parents of its
+// entries, are synthesized. Entries with names escaping the root of the
+// archive are omitted.
+func NewFS(up storage.Unpacker, fg storage.FileGetter) (*FS, error) {
+	fsys := &FS{
+		fg:    fg,
+		nodes: map[string]*fsNode{},
+	}
+	fsys.nodes["."] = &fsNode{name: ".", hdr: syntheticDirHeader(".")}
+	err := iterateEntries(up, func(rec *Record, entry *storage.Entry) error {
+		return fsys.add(rec.Header, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range fsys.nodes {
+		sort.Strings(n.children)
+	}
+	return fsys, nil
+}
+
+func syntheticDirHeader(name string) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0o755,
+	}
+}
+
+// cleanName maps the name of a tar entry to a name as accepted by io/fs.
+func cleanName(name string) (string, bool) {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
+
+func (fsys *FS) add(hdr *tar.Header, entry *storage.Entry) error {
+	switch hdr.Typeflag {
+	case tar.TypeXGlobalHeader:
+		return nil
+	}
+	name, ok := cleanName(hdr.Name)
+	if !ok {
+		return nil
+	}
+	if n, ok := fsys.nodes[name]; ok {
+		// a later entry for the same path wins
+		n.hdr, n.entry = hdr, entry
+		return nil
+	}
+	fsys.nodes[name] = &fsNode{name: name, hdr: hdr, entry: entry}
+
+	// link the node, and any missing parents, into the tree
+	for name != "." {
+		dir := path.Dir(name)
+		parent, ok := fsys.nodes[dir]
+		if !ok {
+			parent = &fsNode{name: dir, hdr: syntheticDirHeader(dir)}
+			fsys.nodes[dir] = parent
+		}
+		parent.children = append(parent.children, path.Base(name))
+		if ok {
+			break
+		}
+		name = dir
+	}
+	return nil
+}
+
+// lookup resolves name to a node, following symbolic links in all but the
+// last element, and in the last element as well if follow is set.
+func (fsys *FS) lookup(op, name string, follow bool) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	links := 0
+	resolved := "."
+	rest := name
+	for rest != "." && rest != "" {
+		var elem string
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			elem, rest = rest[:i], rest[i+1:]
+		} else {
+			elem, rest = rest, ""
+		}
+		cur := path.Join(resolved, elem)
+		n, ok := fsys.nodes[cur]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if n.hdr.Typeflag == tar.TypeSymlink && (rest != "" || follow) {
+			links++
+			if links > maxSymlinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("too many levels of symbolic links")}
+			}
+			target := n.hdr.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(resolved, target)
+			}
+			target, _ = cleanName(target)
+			if rest != "" {
+				rest = path.Join(target, rest)
+			} else {
+				rest = target
+			}
+			resolved = "."
+			continue
+		}
+		resolved = cur
+	}
+	return fsys.nodes[resolved], nil
+}
+
+// payload returns the node holding the payload of n, resolving hardlinks.
+func (fsys *FS) payload(n *fsNode) *fsNode {
+	for i := 0; n.hdr.Typeflag == tar.TypeLink && i < maxSymlinks; i++ {
+		target, ok := cleanName(n.hdr.Linkname)
+		if !ok {
+			return n
+		}
+		t, ok := fsys.nodes[target]
+		if !ok {
+			return n
+		}
+		n = t
+	}
+	return n
+}
+
+// info returns the FileInfo of n, reported under name.
+func (fsys *FS) info(n *fsNode, name string) fs.FileInfo {
+	return fsFileInfo{FileInfo: n.hdr.FileInfo(), name: path.Base(name), size: fsys.payloadSize(n)}
+}
+
+func (fsys *FS) payloadSize(n *fsNode) int64 {
+	p := fsys.payload(n)
+	if p.entry != nil && p.hdr.Typeflag != tar.TypeDir {
+		return p.entry.Size
+	}
+	return n.hdr.Size
+}
+
+// Open opens the named file, following symbolic links.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	n, err := fsys.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	fi := fsys.info(n, name)
+	if fi.IsDir() {
+		return &fsDir{fsys: fsys, node: n, info: fi}, nil
+	}
+	return &fsFile{fsys: fsys, node: fsys.payload(n), info: fi, name: name}, nil
+}
+
+// Stat returns the FileInfo for the named file, following symbolic links.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := fsys.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.info(n, name), nil
+}
+
+// Lstat returns the FileInfo for the named file, without following a
+// symbolic link in its last element.
+func (fsys *FS) Lstat(name string) (fs.FileInfo, error) {
+	n, err := fsys.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.info(n, name), nil
+}
+
+// ReadLink returns the destination of the named symbolic link.
+func (fsys *FS) ReadLink(name string) (string, error) {
+	n, err := fsys.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.hdr.Typeflag != tar.TypeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return n.hdr.Linkname, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by
+// filename.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := fsys.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !n.hdr.FileInfo().IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return fsys.dirEntries(n), nil
+}
+
+func (fsys *FS) dirEntries(n *fsNode) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, c := range n.children {
+		entries = append(entries, fs.FileInfoToDirEntry(fsys.info(fsys.nodes[path.Join(n.name, c)], c)))
+	}
+	return entries
+}
+
+// fsFileInfo overrides the name and size reported by the header's FileInfo,
+// as the former may be a longer path and the latter zero for hardlinks.
+type fsFileInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+func (fi fsFileInfo) Name() string { return fi.name }
+func (fi fsFileInfo) Size() int64  { return fi.size }
+
+type fsFile struct {
+	fsys *FS
+	node *fsNode
+	info fs.FileInfo
+	name string
+
+	rc   io.ReadCloser
+	crc  hash.Hash
+	read int64
+	err  error
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *fsFile) Read(b []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	e := f.node.entry
+	if e == nil || e.Size == 0 {
+		return 0, io.EOF
+	}
+	if f.rc == nil {
+		rc, err := storage.GetPayload(f.fsys.fg, e)
+		if err != nil {
+			f.err = &fs.PathError{Op: "read", Path: f.name, Err: err}
+			return 0, f.err
+		}
+		f.rc = rc
+		f.crc = crc64.New(storage.CRCTable)
+	}
+	if remaining := e.Size - f.read; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+	n, err := f.rc.Read(b)
+	f.crc.Write(b[:n])
+	f.read += int64(n)
+	if f.read == e.Size {
+		if !bytes.Equal(f.crc.Sum(nil), e.Payload) {
+			f.err = &fs.PathError{Op: "read", Path: f.name, Err: fmt.Errorf("file integrity checksum failed for %q", e.GetName())}
+			return n, f.err
+		}
+		f.err = io.EOF
+		return n, nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		f.err = err
+	}
+	return n, err
+}
+
+func (f *fsFile) Close() error {
+	if f.rc != nil {
+		return f.rc.Close()
+	}
+	return nil
+}
+
+type fsDir struct {
+	fsys    *FS
+	node    *fsNode
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: fmt.Errorf("is a directory")}
+}
+
+func (d *fsDir) Close() error { return nil }
+
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = d.fsys.dirEntries(d.node)
+	}
+	rest := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.offset += count
+	return rest[:count], nil
+}
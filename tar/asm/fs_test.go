@@ -0,0 +1,107 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+type testFSEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+var testFSEntries = []testFSEntry{
+	{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "./", Mode: 0o755}},
+	{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "./etc/", Mode: 0o755}},
+	{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "./etc/hostname", Mode: 0o644}, body: "tar-split\n"},
+	{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "./etc/empty", Mode: 0o600}},
+	{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "./etc/hostname.link", Linkname: "./etc/hostname", Mode: 0o644}},
+	{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "./etc/hostname.sym", Linkname: "hostname", Mode: 0o777}},
+	{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "./lib", Linkname: "/usr/lib", Mode: 0o777}},
+	{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "./usr/lib/libfoo.so", Mode: 0o755}, body: string(bytes.Repeat([]byte("libfoo"), 200))},
+}
+
+// newTestFS disassembles a tar archive built from entries, and returns the
+// tar-split metadata and a FileGetPutter holding the payloads.
+func newTestFS(t *testing.T, entries []testFSEntry) ([]byte, storage.FileGetPutter) {
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.body))
+		hdr.ModTime = time.Unix(1500000000, 0)
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := io.WriteString(tw, e.body)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	var tarSplit bytes.Buffer
+	fgp := storage.NewBufferFileGetPutter()
+	rdr, err := NewInputTarStreamWithOptions(&tarball, storage.NewJSONPacker(&tarSplit), fgp, InputOptions{Trailer: true})
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, rdr)
+	require.NoError(t, err)
+	return tarSplit.Bytes(), fgp
+}
+
+func TestFS(t *testing.T) {
+	tarSplit, fgp := newTestFS(t, testFSEntries)
+	fsys, err := NewFS(storage.NewJSONUnpacker(bytes.NewReader(tarSplit)), fgp)
+	require.NoError(t, err)
+
+	err = fstest.TestFS(fsys, "etc/hostname", "etc/empty", "etc/hostname.link", "etc/hostname.sym", "lib", "usr/lib/libfoo.so")
+	require.NoError(t, err)
+
+	b, err := fs.ReadFile(fsys, "etc/hostname.link")
+	require.NoError(t, err)
+	assert.Equal(t, "tar-split\n", string(b))
+	b, err = fs.ReadFile(fsys, "lib/libfoo.so")
+	require.NoError(t, err)
+	assert.Equal(t, testFSEntries[7].body, string(b))
+
+	fi, err := fsys.Stat("etc/hostname.sym")
+	require.NoError(t, err)
+	assert.Equal(t, "hostname.sym", fi.Name())
+	assert.True(t, fi.Mode().IsRegular())
+	assert.Equal(t, int64(10), fi.Size())
+
+	fi, err = fsys.Lstat("etc/hostname.sym")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeSymlink, fi.Mode().Type())
+	target, err := fsys.ReadLink("etc/hostname.sym")
+	require.NoError(t, err)
+	assert.Equal(t, "hostname", target)
+	_, err = fsys.ReadLink("etc/hostname")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+
+	// "usr" and "usr/lib" are not in the archive, but are synthesized
+	fi, err = fsys.Stat("usr/lib")
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+
+	_, err = fsys.Open("etc/missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fsys.Open("../etc/hostname")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
+
+func TestFSChecksumMismatch(t *testing.T) {
+	tarSplit, fgp := newTestFS(t, testFSEntries)
+	fsys, err := NewFS(storage.NewJSONUnpacker(bytes.NewReader(tarSplit)), fgp)
+	require.NoError(t, err)
+
+	_, _, err = fgp.Put("./etc/hostname", bytes.NewBufferString("not-split\n"))
+	require.NoError(t, err)
+	_, err = fs.ReadFile(fsys, "etc/hostname")
+	assert.Error(t, err)
+}
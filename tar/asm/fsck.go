@@ -0,0 +1,214 @@
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// Problem is an inconsistency found in a metadata stream by Check.
+type Problem struct {
+	// Position of the entry the problem was found at
+	Position int
+	// Offset in the assembled tar archive stream the problem was found at
+	Offset int64
+	// Message describing the problem
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("position %d (offset %d): %s", p.Position, p.Offset, p.Message)
+}
+
+// Check validates the internal consistency of the metadata stream provided
+// by the Unpacker, without access to the file payloads, and returns every
+// problem found. The error is only for failing to read the stream.
+//
+// It checks that:
+//   - the entries' positions are continuous
+//   - the SegmentType entries before each FileType entry hold exactly the
+//     padding of the previous file and a valid tar header, with a correct
+//     header checksum, possibly after the zero blocks ending an archive
+//     concatenated with the next one, see InputOptions.IgnoreZeros; numeric
+//     fields are read with tar.LenientNumeric
+//   - the header's size and name match the following FileType entry
+//   - the archive ends with the padding of the last file, and two zero blocks
+//   - the file names are unique, if the Unpacker does not already refuse
+//     duplicates, like storage.NewJSONUnpackerWithDuplicates
+//   - the size recorded in the TrailerType entry, if any, matches
+func Check(up storage.Unpacker) ([]Problem, error) {
+	c := checker{
+		seen:     map[string]int{},
+		position: -1,
+	}
+	up = storage.NewZeroRunUnpacker(up)
+	for {
+		entry, err := up.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if ute, ok := err.(*storage.UnknownTypeError); ok {
+				// the entry is skipped, but the stream can be read on
+				c.report(ute.Position, "%v", ute)
+				c.position = ute.Position
+				continue
+			}
+			return c.problems, err
+		}
+		c.add(entry)
+	}
+	c.end()
+	return c.problems, nil
+}
+
+type checker struct {
+	problems []Problem
+
+	position int   // of the previous entry
+	offset   int64 // in the assembled stream, of the current run
+	sparse   bool  // offsets are unreliable
+
+	run            []byte // payloads of the current run of SegmentType entries
+	runPosition    int    // of the first entry of the run
+	pendingPadding int64  // after the data of the previous file
+	seen           map[string]int
+	ended          bool // the end of the archive was checked
+	announced      bool // the preamble announces a trailer
+}
+
+func (c *checker) report(position int, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{
+		Position: position,
+		Offset:   c.offset,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) add(entry *storage.Entry) {
+	if entry.Position != c.position+1 {
+		c.report(entry.Position, "position is not continuous, previous entry was at position %d", c.position)
+	}
+	c.position = entry.Position
+
+	switch entry.Type {
+	case storage.SegmentType:
+		if c.run == nil {
+			c.runPosition = entry.Position
+			c.run = []byte{}
+		}
+		c.run = append(c.run, entry.Payload...)
+	case storage.FileType:
+		c.file(entry)
+	case storage.PreambleType:
+		if entry.Position != 0 {
+			c.report(entry.Position, "preamble is not the first entry")
+		}
+		pre, err := storage.DecodePreamble(entry)
+		if err != nil {
+			c.report(entry.Position, "%v", err)
+		} else if pre.DigestAlgorithm != "" {
+			c.announced = true
+		}
+	case storage.TrailerType:
+		c.end()
+		if !c.announced {
+			c.report(entry.Position, "trailer is not announced by the preamble")
+		}
+		if !c.sparse && entry.Size != c.offset {
+			c.report(entry.Position, "trailer records a stream of %d bytes, but the entries make up %d bytes", entry.Size, c.offset)
+		}
+	default:
+		if err := storage.CheckType(entry); err != nil {
+			c.report(entry.Position, "%v", err)
+		}
+	}
+}
+
+// padding checks and strips the padding of the previous file from the run.
+func (c *checker) padding() []byte {
+	run := c.run
+	if int64(len(run)) < c.pendingPadding {
+		c.report(c.runPosition, "expected %d bytes of padding after previous file, but only %d bytes follow", c.pendingPadding, len(run))
+		run = nil
+	} else {
+		run = run[c.pendingPadding:]
+	}
+	c.pendingPadding = 0
+	return run
+}
+
+func (c *checker) file(entry *storage.Entry) {
+	name := entry.GetName()
+	defer func() {
+		c.offset += int64(len(c.run)) + entry.Size
+		c.run = nil
+	}()
+
+	cName := filepath.Clean(name)
+	if prev, ok := c.seen[cName]; ok {
+		c.report(entry.Position, "duplicate file name %q, first at position %d", name, prev)
+	} else {
+		c.seen[cName] = entry.Position
+	}
+
+	if c.run == nil {
+		c.report(entry.Position, "file entry %q is not preceded by a header segment", name)
+		return
+	}
+	run := c.padding()
+	run = run[zeroBlocks(run):]
+	br := bytes.NewReader(run)
+	tr := tar.NewReader(br)
+	tr.Leniency = tar.LenientNumeric
+	hdr, err := tr.Next()
+	if err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("end of archive")
+		}
+		c.report(c.runPosition, "invalid tar header for file entry %q: %v", name, err)
+		return
+	}
+	if storage.IsSparse(hdr) {
+		c.sparse = true
+	} else if br.Len() != 0 {
+		c.report(c.runPosition, "%d bytes follow the tar header for %q", br.Len(), hdr.Name)
+	}
+	if hdr.Name != name {
+		c.report(entry.Position, "file entry name %q does not match the tar header name %q", name, hdr.Name)
+	}
+	if hdr.Size != entry.Size {
+		c.report(entry.Position, "file entry size %d does not match the tar header size %d for %q", entry.Size, hdr.Size, hdr.Name)
+	}
+	c.pendingPadding = tr.ExpectedPadding()
+}
+
+// end checks the final run of SegmentType entries, the end of the archive.
+func (c *checker) end() {
+	if c.ended || c.position < 0 {
+		return
+	}
+	c.ended = true
+	defer func() {
+		c.offset += int64(len(c.run))
+		c.run = nil
+	}()
+	if c.run == nil && c.pendingPadding > 0 {
+		c.report(c.position, "archive ends without the padding of the last file")
+		return
+	}
+	run := c.padding()
+	if len(run) < 2*512 || !bytes.Equal(run[:2*512], make([]byte, 2*512)) {
+		tr := tar.NewReader(bytes.NewReader(run))
+		tr.Leniency = tar.LenientNumeric
+		if hdr, err := tr.Next(); err == nil {
+			c.report(c.runPosition, "tar header for %q is not followed by a file entry", hdr.Name)
+			return
+		}
+		c.report(c.position, "archive does not end with two zero blocks")
+	}
+}
@@ -0,0 +1,135 @@
+package asm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func unpackAll(t *testing.T, tarSplit []byte) []storage.Entry {
+	var entries []storage.Entry
+	jup := storage.NewJSONUnpacker(bytes.NewReader(tarSplit))
+	for {
+		e, err := jup.Next()
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		entries = append(entries, *e)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, tc := range testCases {
+		fh, err := os.Open(tc.path)
+		require.NoError(t, err)
+		defer fh.Close()
+		gzRdr, err := gzip.NewReader(fh)
+		require.NoError(t, err)
+		defer gzRdr.Close()
+
+		w := bytes.NewBuffer([]byte{})
+		tarStream, err := NewInputTarStream(gzRdr, storage.NewJSONPacker(w), nil)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, tarStream)
+		require.NoError(t, err)
+
+		problems, err := Check(storage.NewJSONUnpacker(w))
+		require.NoError(t, err)
+		// these archives lack the end-of-archive zero blocks
+		if strings.Contains(tc.path, "notenoughnils") || strings.Contains(tc.path, "1c51fc286aa9") {
+			require.Len(t, problems, 1, tc.path)
+			assert.Contains(t, problems[0].Message, "two zero blocks")
+			continue
+		}
+		assert.Empty(t, problems, tc.path)
+	}
+}
+
+func TestCheckProblems(t *testing.T) {
+	tarSplit, _ := newTestFS(t, testFSEntries)
+	entries := unpackAll(t, tarSplit)
+	// 0: preamble, 1: "./" header, 2: "./" file, 3: "./etc/" header, 4: "./etc/" file,
+	// 5: "./etc/hostname" header, 6: "./etc/hostname" file, 7: its padding and the next header...
+	var lastFile int
+	for i, e := range entries {
+		if e.Type == storage.FileType {
+			lastFile = i
+		}
+	}
+
+	for _, tc := range []struct {
+		mangle   func(entries []storage.Entry) []storage.Entry
+		position int
+		message  string
+	}{
+		{
+			mangle:   func(entries []storage.Entry) []storage.Entry { entries[3].Payload[0] ^= 1; return entries },
+			position: 3,
+			message:  "invalid tar header",
+		},
+		{
+			mangle:   func(entries []storage.Entry) []storage.Entry { entries[6].Size++; return entries },
+			position: 6,
+			message:  "does not match the tar header size",
+		},
+		{
+			mangle: func(entries []storage.Entry) []storage.Entry {
+				entries[7].Payload = entries[7].Payload[1:]
+				return entries
+			},
+			position: 7,
+			message:  "invalid tar header",
+		},
+		{
+			mangle:   func(entries []storage.Entry) []storage.Entry { entries[4].Name = "./etc/hostname"; return entries },
+			position: 4,
+			message:  "does not match the tar header name",
+		},
+		{
+			mangle:   func(entries []storage.Entry) []storage.Entry { entries[5].Position = 42; return entries },
+			position: 42,
+			message:  "not continuous",
+		},
+		{
+			mangle:   func(entries []storage.Entry) []storage.Entry { return entries[:lastFile+1] },
+			position: lastFile,
+			message:  "without the padding",
+		},
+		{
+			mangle: func(entries []storage.Entry) []storage.Entry {
+				entries[len(entries)-1].Size--
+				return entries
+			},
+			position: len(entries) - 1,
+			message:  "trailer records",
+		},
+	} {
+		mangled := make([]storage.Entry, len(entries))
+		for i, e := range entries {
+			e.Payload = append([]byte(nil), e.Payload...)
+			mangled[i] = e
+		}
+		problems, err := Check(storage.NewEntriesUnpacker(tc.mangle(mangled)))
+		require.NoError(t, err)
+		require.NotEmpty(t, problems, tc.message)
+		assert.Equal(t, tc.position, problems[0].Position, problems)
+		assert.Contains(t, problems[0].Message, tc.message)
+	}
+
+	// every problem is reported
+	mangled := append([]storage.Entry{}, entries...)
+	mangled[4].Name = "./etc/hostname"
+	problems, err := Check(storage.NewEntriesUnpacker(mangled))
+	require.NoError(t, err)
+	require.Len(t, problems, 2)
+	assert.Contains(t, problems[1].Message, "duplicate file name")
+	assert.Equal(t, 6, problems[1].Position)
+}
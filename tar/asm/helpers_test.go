@@ -0,0 +1,33 @@
+package asm
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// testFile is a file of the archives written by writeTestArchive.
+type testFile struct {
+	hdr  tar.Header
+	body string
+}
+
+// writeTestArchive writes the files to w through a Writer with opts, with
+// their sizes set from their bodies and a fixed modification time.
+func writeTestArchive(t *testing.T, files []testFile, w io.Writer, p storage.Packer, fp storage.FilePutter, opts InputOptions) {
+	tw, err := NewWriterWithOptions(w, p, fp, opts)
+	require.NoError(t, err)
+	for _, f := range files {
+		hdr := f.hdr
+		hdr.Size = int64(len(f.body))
+		hdr.ModTime = time.Unix(1500000000, 0)
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := io.WriteString(tw, f.body)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+}
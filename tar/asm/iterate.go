@@ -4,38 +4,154 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
 
 	"github.com/vbatts/tar-split/archive/tar"
 	"github.com/vbatts/tar-split/tar/storage"
 )
 
 // IterateHeaders calls handler for each tar header provided by Unpacker
+//
+// The headers are those a tar.Reader returns for the archive, the PAX global
+// headers (TypeXGlobalHeader) included, whose records are not applied to the
+// following headers. See Record.GlobalRecords to apply them.
+//
+// The records of vendor extensions are all kept in PAXRecords, with accessors
+// like tar.Header.ACL, FileFlags and VendorRecords, and entries of extension
+// types, like tar.TypeSolarisACL, are passed as they are.
+//
+// The headers are read with the InputOptions.Leniency that the preamble
+// records, if any, or else with tar.Diagnose, and their Diagnostics tell how
+// they deviate from the tar format, if at all.
+//
+// Entries of ignorable types that are not handled are skipped, critical ones
+// cause a *storage.UnknownTypeError.
 func IterateHeaders(unpacker storage.Unpacker, handler func(hdr *tar.Header) error) error {
+	return iterateEntries(unpacker, func(rec *Record, _ *storage.Entry) error {
+		return handler(rec.Header)
+	})
+}
+
+// Record describes a file of the archive provided by an Unpacker, for
+// IterateRecords.
+type Record struct {
+	// Header of the file, as from IterateHeaders
+	Header *tar.Header
+	// RawHeader is the raw bytes of the header, including any extended
+	// headers, without the padding of the previous file
+	RawHeader []byte
+	// Checksum of the payload, see storage.CRCTable, or nil if there is none
+	Checksum []byte
+
+	// HeaderPosition is the position of the SegmentType entry of the header
+	HeaderPosition int
+	// FilePosition is the position of the FileType entry of the payload, or
+	// -1 if there is none
+	FilePosition int
+
+	// HeaderOffset is the offset of the header in the assembled archive
+	HeaderOffset int64
+	// DataOffset is the offset of the payload in the assembled archive
+	DataOffset int64
+
+	// GlobalRecords are the records of the PAX global headers before the
+	// header, which carry over to it, or nil if there are none. They are
+	// not applied to Header, see HeaderWithGlobals.
+	GlobalRecords map[string]string
+}
+
+// HeaderWithGlobals returns a copy of Header, with the GlobalRecords applied
+// unless its own extended header has them. Global records for the path, link
+// path and size are not applied, as they identify each file.
+func (rec *Record) HeaderWithGlobals() (*tar.Header, error) {
+	hdr := cloneHeader(rec.Header)
+	if hdr.Typeflag == tar.TypeXGlobalHeader {
+		return hdr, nil
+	}
+	if err := globalRecords(rec.GlobalRecords).apply(hdr); err != nil {
+		return nil, fmt.Errorf("applying PAX global records to %q: %w", hdr.Name, err)
+	}
+	return hdr, nil
+}
+
+// IterateRecords calls handler for each file of the archive provided by the
+// Unpacker, with its header and what the metadata records about it. See
+// IterateHeaders.
+//
+// The offsets are not reliable after a sparse file, as the metadata does not
+// record how it is stored in the archive.
+func IterateRecords(unpacker storage.Unpacker, handler func(rec *Record) error) error {
+	return iterateEntries(unpacker, func(rec *Record, _ *storage.Entry) error {
+		return handler(rec)
+	})
+}
+
+// iterateEntries calls handler for each tar header provided by Unpacker,
+// together with the FileType entry recording its payload. If there is no
+// FileType entry following the header, entry is nil.
+func iterateEntries(unpacker storage.Unpacker, handler func(rec *Record, entry *storage.Entry) error) error {
 	// We assume about NewInputTarStream:
 	// - There is a separate SegmentType entry for every tar header, but only one SegmentType entry for the full header incl. any extensions
-	// - (There is a FileType entry for every tar header, we ignore it)
+	// - There is a FileType entry for every tar header, right after its SegmentType entry
 	// - Trailing padding of a file, if any, is included in the next SegmentType entry
 	// - At the end, there may be SegmentType entries just for the terminating zero blocks.
+	// Unless the SegmentType entries have a storage.SegmentKind, and the padding is separate.
+
+	var pending *Record
+	flush := func(entry *storage.Entry) error {
+		if pending == nil {
+			return nil
+		}
+		rec := pending
+		pending = nil
+		if entry != nil {
+			rec.FilePosition = entry.Position
+			if entry.Size > 0 {
+				rec.Checksum = entry.Payload
+			}
+		}
+		return handler(rec, entry)
+	}
 
+	unpacker = storage.NewZeroRunUnpacker(unpacker)
+	leniency := tar.Diagnose
+	globals := globalRecords{}
 	var pendingPadding int64 = 0
+	var offset int64 // in the assembled archive, of the current entry
 	for {
 		tsEntry, err := unpacker.Next()
 		if err != nil {
 			if err == io.EOF {
-				return nil
+				return flush(nil)
 			}
 			return fmt.Errorf("reading tar-split entries: %w", err)
 		}
 		switch tsEntry.Type {
 		case storage.SegmentType:
+			if err := flush(nil); err != nil {
+				return err
+			}
+			segmentOffset := offset
+			offset += int64(len(tsEntry.Payload))
 			payload := tsEntry.Payload
-			if int64(len(payload)) < pendingPadding {
-				return fmt.Errorf("expected %d bytes of padding after previous file, but next SegmentType only has %d bytes", pendingPadding, len(payload))
+			switch tsEntry.Kind {
+			case storage.HeaderSegment:
+				// the padding of the previous file has a segment of its own
+			case "":
+				if int64(len(payload)) < pendingPadding {
+					return fmt.Errorf("expected %d bytes of padding after previous file, but next SegmentType only has %d bytes", pendingPadding, len(payload))
+				}
+				payload = payload[pendingPadding:]
+				segmentOffset += pendingPadding
+				pendingPadding = 0
+			default:
+				// padding, and the end of the archive
+				continue
 			}
-			payload = payload[pendingPadding:]
-			pendingPadding = 0
 
-			tr := tar.NewReader(bytes.NewReader(payload))
+			br := bytes.NewReader(payload)
+			tr := tar.NewReader(br)
+			tr.Leniency = leniency
 			hdr, err := tr.Next()
 			if err != nil {
 				if err == io.EOF { // Probably the last entry, but let’s let the unpacker drive that.
@@ -43,15 +159,99 @@ func IterateHeaders(unpacker storage.Unpacker, handler func(hdr *tar.Header) err
 				}
 				return fmt.Errorf("decoding a tar header from a tar-split entry: %w", err)
 			}
-			if err := handler(hdr); err != nil {
-				return err
+			var recordGlobals map[string]string
+			if hdr.Typeflag == tar.TypeXGlobalHeader {
+				globals.update(hdr)
+			} else if len(globals) > 0 {
+				recordGlobals = globals.clone()
+			}
+			rawHeader := payload[:len(payload)-br.Len()]
+			pending = &Record{
+				Header:         hdr,
+				RawHeader:      rawHeader,
+				HeaderPosition: tsEntry.Position,
+				FilePosition:   -1,
+				HeaderOffset:   segmentOffset,
+				DataOffset:     segmentOffset + int64(len(rawHeader)),
+				GlobalRecords:  recordGlobals,
+			}
+			if tsEntry.Kind == "" {
+				pendingPadding = tr.ExpectedPadding()
 			}
-			pendingPadding = tr.ExpectedPadding()
 
 		case storage.FileType:
+			offset += tsEntry.Size
+			if err := flush(tsEntry); err != nil {
+				return err
+			}
+		case storage.PreambleType:
+			pre, err := storage.DecodePreamble(tsEntry)
+			if err != nil {
+				return err
+			}
+			if v, ok := pre.Options["leniency"]; ok {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("invalid leniency %q in the tar-split preamble", v)
+				}
+				leniency = tar.Leniency(n)
+			}
+		case storage.TrailerType:
 			// Nothing
 		default:
-			return fmt.Errorf("unexpected tar-split entry type %q", tsEntry.Type)
+			if tsEntry.Type.Critical() {
+				return &storage.UnknownTypeError{Type: tsEntry.Type, Position: tsEntry.Position}
+			}
+		}
+	}
+}
+
+// globalRecords are the records of the PAX global headers read so far.
+type globalRecords map[string]string
+
+// update records the records of the PAX global header hdr. Records with an
+// empty value delete the previous global record.
+func (g globalRecords) update(hdr *tar.Header) {
+	for k, v := range hdr.PAXRecords {
+		if v == "" {
+			delete(g, k)
+		} else {
+			g[k] = v
+		}
+	}
+}
+
+func (g globalRecords) clone() map[string]string {
+	c := make(map[string]string, len(g))
+	for k, v := range g {
+		c[k] = v
+	}
+	return c
+}
+
+// apply sets the global records in hdr, unless its own extended header has
+// them.
+func (g globalRecords) apply(hdr *tar.Header) error {
+	records := map[string]string{}
+	for k, v := range g {
+		switch k {
+		case "path", "linkpath", "size":
+			continue
+		}
+		if _, ok := hdr.PAXRecords[k]; !ok {
+			records[k] = v
 		}
 	}
+	if len(records) == 0 {
+		return nil
+	}
+	local := hdr.PAXRecords
+	if err := tar.MergePAX(hdr, records); err != nil {
+		return err
+	}
+	for k, v := range local {
+		records[k] = v
+	}
+	hdr.PAXRecords = records
+	return nil
 }
@@ -0,0 +1,30 @@
+//go:build go1.23
+// +build go1.23
+
+package asm
+
+import (
+	"errors"
+	"iter"
+
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+var errStopIteration = errors.New("iteration stopped")
+
+// Records returns an iterator over the files of the archive provided by the
+// Unpacker, like IterateRecords. If iterating fails, the error is yielded last,
+// with a nil Record.
+func Records(unpacker storage.Unpacker) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		err := IterateRecords(unpacker, func(rec *Record) error {
+			if !yield(rec, nil) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err != nil && err != errStopIteration {
+			yield(nil, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+//go:build go1.23
+// +build go1.23
+
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func TestRecords(t *testing.T) {
+	tarSplit, _ := newTestFS(t, testFSEntries)
+
+	var names []string
+	for rec, err := range Records(storage.NewJSONUnpacker(bytes.NewReader(tarSplit))) {
+		require.NoError(t, err)
+		names = append(names, rec.Header.Name)
+	}
+	assert.Len(t, names, len(testFSEntries))
+
+	// stopping early
+	var n int
+	for _, err := range Records(storage.NewJSONUnpacker(bytes.NewReader(tarSplit))) {
+		require.NoError(t, err)
+		n++
+		if n == 2 {
+			break
+		}
+	}
+	assert.Equal(t, 2, n)
+
+	// the error comes last
+	var last error
+	for rec, err := range Records(storage.NewEntriesUnpacker([]storage.Entry{{Type: 42}})) {
+		assert.Nil(t, rec)
+		last = err
+	}
+	var ute *storage.UnknownTypeError
+	assert.True(t, errors.As(last, &ute), last)
+}
@@ -2,8 +2,11 @@ package asm
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"hash/crc64"
 	"io"
+	"os"
 	"testing"
 	"time"
 
@@ -117,3 +120,178 @@ func TestIterateHeaders(t *testing.T) {
 		assert.Equal(t, expected.Format, actual.Format)
 	}
 }
+
+func TestIterateHeadersPAXGlobal(t *testing.T) {
+	fh, err := os.Open("../../archive/tar/testdata/pax-global-records.tar")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	var tarSplit bytes.Buffer
+	tsReader, err := NewInputTarStream(fh, storage.NewJSONPacker(&tarSplit), storage.NewDiscardFilePutter())
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, tsReader)
+	require.NoError(t, err)
+
+	// the headers are those of tar.Reader, with the global records apart
+	_, err = fh.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	tr := tar.NewReader(fh)
+	var records []*Record
+	err = IterateRecords(storage.NewJSONUnpacker(&tarSplit), func(rec *Record) error {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		assert.Equal(t, hdr, rec.Header)
+		records = append(records, rec)
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = tr.Next()
+	require.Equal(t, io.EOF, err)
+
+	global := time.Unix(1500000000, 0)
+	expected := []struct {
+		typeFlag byte
+		name     string
+		modTime  time.Time
+		records  map[string]string
+		globals  map[string]string
+	}{
+		{tar.TypeXGlobalHeader, "global1", time.Time{}, map[string]string{"path": "global1", "mtime": "1500000000.0"}, nil},
+		// the global path does not rename the files
+		{tar.TypeReg, "file1", global, map[string]string{"mtime": "1500000000.0"}, map[string]string{"path": "global1", "mtime": "1500000000.0"}},
+		{tar.TypeReg, "file2", global, map[string]string{"path": "file2", "mtime": "1500000000.0"}, map[string]string{"path": "global1", "mtime": "1500000000.0"}},
+		{tar.TypeXGlobalHeader, "GlobalHead.0.0", time.Time{}, map[string]string{"path": ""}, nil},
+		{tar.TypeReg, "file3", global, map[string]string{"mtime": "1500000000.0"}, map[string]string{"mtime": "1500000000.0"}},
+		// local records override the global ones
+		{tar.TypeReg, "file4", time.Unix(1400000000, 0), map[string]string{"mtime": "1400000000"}, map[string]string{"mtime": "1500000000.0"}},
+	}
+	require.Len(t, records, len(expected))
+	for i, e := range expected {
+		assert.Equal(t, e.globals, records[i].GlobalRecords, i)
+		hdr, err := records[i].HeaderWithGlobals()
+		require.NoError(t, err)
+		assert.Equal(t, e.typeFlag, hdr.Typeflag, i)
+		assert.Equal(t, e.name, hdr.Name, i)
+		assert.True(t, hdr.ModTime.Equal(e.modTime), "%d: %v", i, hdr.ModTime)
+		assert.Equal(t, e.records, hdr.PAXRecords, i)
+	}
+	// the header itself is left alone
+	assert.Nil(t, records[1].Header.PAXRecords)
+}
+
+func TestIterateHeadersVendorExtensions(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	hdr := &tar.Header{
+		Name:       "file1",
+		Mode:       0o644,
+		Typeflag:   tar.TypeReg,
+		PAXRecords: map[string]string{"LIBARCHIVE.symlinktype": "file"},
+	}
+	hdr.SetACL(tar.ACL{Access: []string{"user::rw-", "group::r--", "other::r--"}})
+	hdr.SetFileFlags([]string{"nodump"})
+	require.NoError(t, tw.WriteHeader(hdr))
+	// an entry of a Solaris extension type, with its data
+	solarisACL := "1000003\x00user::rw-,group::r--,other:r--\x00"
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "acl", Typeflag: tar.TypeSolarisACL, Size: int64(len(solarisACL)), Format: tar.FormatUSTAR}))
+	_, err := io.WriteString(tw, solarisACL)
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "file2", Mode: 0o644, Typeflag: tar.TypeReg, Format: tar.FormatUSTAR}))
+	require.NoError(t, tw.Close())
+
+	var tarSplit bytes.Buffer
+	fgp := storage.NewBufferFileGetPutter()
+	tsReader, err := NewInputTarStream(bytes.NewReader(archive.Bytes()), storage.NewJSONPacker(&tarSplit), fgp)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, tsReader)
+	require.NoError(t, err)
+
+	var actual []*tar.Header
+	err = IterateHeaders(storage.NewJSONUnpacker(bytes.NewReader(tarSplit.Bytes())), func(hdr *tar.Header) error {
+		actual = append(actual, hdr)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, actual, 3)
+	assert.Equal(t, []string{"user::rw-", "group::r--", "other::r--"}, actual[0].ACL().Access)
+	assert.Equal(t, []string{"nodump"}, actual[0].FileFlags())
+	assert.Equal(t, map[string]string{"symlinktype": "file"}, actual[0].VendorRecords("LIBARCHIVE"))
+	assert.Equal(t, byte(tar.TypeSolarisACL), actual[1].Typeflag)
+	assert.Equal(t, int64(len(solarisACL)), actual[1].Size)
+	assert.Equal(t, byte(tar.TypeReg), actual[2].Typeflag)
+
+	var assembled bytes.Buffer
+	require.NoError(t, WriteOutputTarStream(fgp, storage.NewJSONUnpacker(bytes.NewReader(tarSplit.Bytes())), &assembled))
+	assert.Equal(t, archive.Bytes(), assembled.Bytes())
+}
+
+func TestIterateRecords(t *testing.T) {
+	for _, tc := range testCases {
+		for _, opts := range []InputOptions{{}, {SegmentKinds: true}} {
+			fh, err := os.Open(tc.path)
+			require.NoError(t, err)
+			gzRdr, err := gzip.NewReader(fh)
+			require.NoError(t, err)
+
+			var tarball, tarSplit bytes.Buffer
+			tsReader, err := NewInputTarStreamWithOptions(gzRdr, storage.NewJSONPacker(&tarSplit), nil, opts)
+			require.NoError(t, err)
+			_, err = io.Copy(&tarball, tsReader)
+			require.NoError(t, err)
+			gzRdr.Close()
+			fh.Close()
+
+			archive := tarball.Bytes()
+			var n int
+			err = IterateRecords(storage.NewJSONUnpacker(&tarSplit), func(rec *Record) error {
+				n++
+				require.Equal(t, rec.RawHeader, archive[rec.HeaderOffset:rec.DataOffset], "%s: %q", tc.path, rec.Header.Name)
+				require.Greater(t, rec.FilePosition, rec.HeaderPosition)
+				if rec.Header.Size == 0 {
+					assert.Nil(t, rec.Checksum)
+					return nil
+				}
+				c := crc64.New(storage.CRCTable)
+				c.Write(archive[rec.DataOffset : rec.DataOffset+rec.Header.Size])
+				assert.Equal(t, c.Sum(nil), rec.Checksum, "%s: %q", tc.path, rec.Header.Name)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.NotZero(t, n, tc.path)
+		}
+	}
+}
+
+func TestUnknownEntryTypes(t *testing.T) {
+	tarSplit, fgp := newTestFS(t, testFSEntries)
+	var entries []storage.Entry
+	jup := storage.NewJSONUnpacker(bytes.NewReader(tarSplit))
+	for {
+		e, err := jup.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		entries = append(entries, *e)
+	}
+	with := func(typ storage.Type) []storage.Entry {
+		res := append([]storage.Entry{}, entries[:3]...)
+		res = append(res, storage.Entry{Type: typ, Payload: []byte("extension")})
+		return append(res, entries[3:]...)
+	}
+
+	// ignorable entries are skipped by all consumers
+	ignorable := storage.IgnorableTypeFlag | 0x80
+	var tarball bytes.Buffer
+	require.NoError(t, WriteOutputTarStream(fgp, storage.NewEntriesUnpacker(with(ignorable)), &tarball))
+	require.NoError(t, IterateHeaders(storage.NewEntriesUnpacker(with(ignorable)), func(hdr *tar.Header) error { return nil }))
+	_, err := NewFS(storage.NewEntriesUnpacker(with(ignorable)), fgp)
+	require.NoError(t, err)
+
+	// critical ones fail all consumers
+	var ute *storage.UnknownTypeError
+	require.ErrorAs(t, WriteOutputTarStream(fgp, storage.NewEntriesUnpacker(with(42)), io.Discard), &ute)
+	require.ErrorAs(t, IterateHeaders(storage.NewEntriesUnpacker(with(42)), func(hdr *tar.Header) error { return nil }), &ute)
+	_, err = NewFS(storage.NewEntriesUnpacker(with(42)), fgp)
+	require.ErrorAs(t, err, &ute)
+}
@@ -0,0 +1,157 @@
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// VerifyOverlay checks that the overlayfs upper directory upperdir holds the
+// content of the archive described by the Unpacker, so that the archive can be
+// reassembled from it with storage.NewOverlayFileGetter.
+//
+// Every entry must exist on disk with the same type, regular files must match
+// the recorded size and checksum, and symbolic links their target. The
+// AUFS-style whiteouts of the archive must be matched by overlayfs whiteouts
+// on disk. Then upperdir is walked, and the files, whiteouts and opaque
+// directories on disk that the archive does not have are reported too, save
+// for the parent directories of its files.
+//
+// Names with ".." elements escaping upperdir are refused.
+func VerifyOverlay(up storage.Unpacker, upperdir string) error {
+	fg := storage.NewOverlayFileGetter(upperdir)
+	names := map[string]bool{}
+	whiteouts := map[string]bool{}
+	opaques := map[string]bool{}
+	addName := func(name string) {
+		for name != "." && !names[name] {
+			names[name] = true
+			name = path.Dir(name)
+		}
+	}
+	err := iterateEntries(up, func(rec *Record, entry *storage.Entry) error {
+		hdr := rec.Header
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			return nil
+		}
+		if cleaned := path.Clean(hdr.Name); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return fmt.Errorf("%q escapes the upper directory", hdr.Name)
+		}
+		name := strings.Join(splitName(hdr.Name), "/")
+		if name == "" {
+			return nil
+		}
+		if target, opaque, ok := storage.ParseWhiteout(name); ok {
+			if opaque {
+				opaques[target] = true
+				addName(target)
+			} else {
+				whiteouts[target] = true
+				addName(path.Dir(target))
+			}
+			rc, err := fg.Get(name)
+			if err != nil {
+				return err
+			}
+			return rc.Close()
+		}
+		addName(name)
+
+		p := filepath.Join(upperdir, name)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		expected := hdr.FileInfo().Mode().Type()
+		if hdr.Typeflag == tar.TypeLink {
+			expected = 0 // a hardlink is a regular file on disk
+		}
+		if fi.Mode().Type() != expected {
+			return fmt.Errorf("type mismatch for %q: expected %v; got %v", hdr.Name, expected, fi.Mode().Type())
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if target != hdr.Linkname {
+				return fmt.Errorf("symlink target mismatch for %q: expected %q; got %q", hdr.Name, hdr.Linkname, target)
+			}
+		case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+			if entry == nil || entry.Size == 0 {
+				if fi.Size() != 0 {
+					return fmt.Errorf("size mismatch for %q: expected 0; got %d", hdr.Name, fi.Size())
+				}
+				return nil
+			}
+			rc, err := storage.GetPayload(fg, entry)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			crc := crc64.New(storage.CRCTable)
+			n, err := io.Copy(crc, rc)
+			if err != nil {
+				return err
+			}
+			if n != entry.Size {
+				return fmt.Errorf("size mismatch for %q: expected %d; got %d", hdr.Name, entry.Size, n)
+			}
+			if !bytes.Equal(crc.Sum(nil), entry.Payload) {
+				return fmt.Errorf("file integrity checksum failed for %q", hdr.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(upperdir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upperdir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		wh, err := storage.IsOverlayWhiteout(p)
+		if err != nil {
+			return err
+		}
+		if wh {
+			if !whiteouts[name] {
+				return fmt.Errorf("overlay whiteout for %q is not in the archive", name)
+			}
+			return nil
+		}
+		if !names[name] {
+			return fmt.Errorf("%q is not in the archive", name)
+		}
+		if d.IsDir() {
+			opaque, err := storage.IsOverlayOpaque(p)
+			if err != nil {
+				return err
+			}
+			if opaque && !opaques[name] {
+				return fmt.Errorf("directory %q is opaque, but not in the archive", name)
+			}
+		}
+		return nil
+	})
+}
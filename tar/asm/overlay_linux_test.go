@@ -0,0 +1,88 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func TestVerifyOverlay(t *testing.T) {
+	upper := t.TempDir()
+	if err := os.Mkdir(filepath.Join(upper, "etc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setxattr(filepath.Join(upper, "etc"), "user.overlay.opaque", []byte("y"), 0); err != nil {
+		t.Skipf("setting user xattrs is not supported: %v", err)
+	}
+	if err := syscall.Mknod(filepath.Join(upper, "gone"), syscall.S_IFCHR, 0); err != nil {
+		t.Skipf("creating whiteouts is not permitted: %v", err)
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(upper, "var"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(upper, "etc", "hostname"), []byte("tar-split\n"), 0o644))
+	require.NoError(t, os.Symlink("hostname", filepath.Join(upper, "etc", "hostname.sym")))
+
+	entries := []testFSEntry{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0o755}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "etc/.wh..wh..opq", Mode: 0o644}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "etc/hostname", Mode: 0o644}, body: "tar-split\n"},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "etc/hostname.sym", Linkname: "hostname", Mode: 0o777}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: ".wh.gone", Mode: 0o644}},
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "var/", Mode: 0o755}},
+	}
+	tarSplit, _ := newTestFS(t, entries)
+	require.NoError(t, VerifyOverlay(storage.NewJSONUnpacker(bytes.NewReader(tarSplit)), upper))
+
+	// the archive can be reassembled from the upper directory
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.body))
+		hdr.ModTime = time.Unix(1500000000, 0)
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := io.WriteString(tw, e.body)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	var output bytes.Buffer
+	require.NoError(t, WriteOutputTarStream(storage.NewOverlayFileGetter(upper), storage.NewJSONUnpacker(bytes.NewReader(tarSplit)), &output))
+	require.Equal(t, tarball.Bytes(), output.Bytes())
+
+	// the files, whiteouts and opaque directories on disk need to be in the
+	// archive too
+	extra := filepath.Join(upper, "etc", "extra")
+	require.NoError(t, os.WriteFile(extra, nil, 0o644))
+	require.ErrorContains(t, VerifyOverlay(storage.NewJSONUnpacker(bytes.NewReader(tarSplit)), upper), "not in the archive")
+	require.NoError(t, os.Remove(extra))
+	require.NoError(t, syscall.Mknod(extra, syscall.S_IFCHR, 0))
+	require.ErrorContains(t, VerifyOverlay(storage.NewJSONUnpacker(bytes.NewReader(tarSplit)), upper), "overlay whiteout")
+	require.NoError(t, os.Remove(extra))
+	require.NoError(t, syscall.Setxattr(filepath.Join(upper, "var"), "user.overlay.opaque", []byte("y"), 0))
+	require.ErrorContains(t, VerifyOverlay(storage.NewJSONUnpacker(bytes.NewReader(tarSplit)), upper), "opaque")
+	require.NoError(t, syscall.Removexattr(filepath.Join(upper, "var"), "user.overlay.opaque"))
+	require.NoError(t, VerifyOverlay(storage.NewJSONUnpacker(bytes.NewReader(tarSplit)), upper))
+
+	// names cannot escape the upper directory
+	escaping, _ := newTestFS(t, []testFSEntry{
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "etc/../../hostname", Mode: 0o644}},
+	})
+	require.ErrorContains(t, VerifyOverlay(storage.NewJSONUnpacker(bytes.NewReader(escaping)), upper), "escapes")
+
+	// a whiteout in the archive needs one on disk
+	require.NoError(t, os.Remove(filepath.Join(upper, "gone")))
+	require.Error(t, VerifyOverlay(storage.NewJSONUnpacker(bytes.NewReader(tarSplit)), upper))
+
+	// and a whiteout on disk is not a file
+	require.NoError(t, syscall.Mknod(filepath.Join(upper, "etc", "hostname"+".tmp"), syscall.S_IFCHR, 0))
+	require.NoError(t, os.Rename(filepath.Join(upper, "etc", "hostname.tmp"), filepath.Join(upper, "etc", "hostname")))
+	_, err := storage.NewOverlayFileGetter(upper).Get("etc/hostname")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
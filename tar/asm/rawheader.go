@@ -0,0 +1,216 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vbatts/tar-split/archive/tar"
+)
+
+const blockSize = 512
+
+// offsets of the fields of a raw tar header block
+const (
+	sizeField     = 124
+	sizeFieldLen  = 12
+	chksumField   = 148
+	chksumLen     = 8
+	typeflagField = 156
+)
+
+var errSparseUnsupported = errors.New("sparse files are not supported")
+
+// blockPadding returns the padding after a payload of size bytes.
+func blockPadding(size int64) int64 {
+	return -size & (blockSize - 1)
+}
+
+// patchHeaderSize rewrites the raw bytes of a tar header, including any
+// extended headers, for a payload of size bytes: the size field of the
+// header, the size record of its PAX extended header if any, and the header
+// checksums. All other bytes are kept, and the numeric fields keep their
+// formatting.
+func patchHeaderSize(raw []byte, size int64) ([]byte, error) {
+	var out []byte
+	var paxSize bool
+	for len(raw) > 0 {
+		if len(raw) < blockSize {
+			return nil, errors.New("truncated tar header")
+		}
+		blk := append([]byte(nil), raw[:blockSize]...)
+		raw = raw[blockSize:]
+
+		switch blk[typeflagField] {
+		case tar.TypeXHeader, tar.TypeXGlobalHeader, tar.TypeGNULongName, tar.TypeGNULongLink:
+			n, err := parseNumericField(blk[sizeField : sizeField+sizeFieldLen])
+			if err != nil {
+				return nil, err
+			}
+			padded := n + blockPadding(n)
+			if n < 0 || int64(len(raw)) < padded {
+				return nil, errors.New("truncated tar extended header")
+			}
+			data := raw[:n]
+			raw = raw[padded:]
+			if blk[typeflagField] == tar.TypeXHeader {
+				var found bool
+				data, found, err = patchPAXSize(data, size)
+				if err != nil {
+					return nil, err
+				}
+				if found {
+					paxSize = true
+					if err := setNumericField(blk[sizeField:sizeField+sizeFieldLen], int64(len(data))); err != nil {
+						return nil, err
+					}
+				}
+			}
+			setChecksum(blk)
+			out = append(out, blk...)
+			out = append(out, data...)
+			out = append(out, make([]byte, blockPadding(int64(len(data))))...)
+		case tar.TypeGNUSparse:
+			return nil, errSparseUnsupported
+		default:
+			if len(raw) != 0 {
+				return nil, errors.New("unexpected data after the tar header")
+			}
+			if err := setNumericField(blk[sizeField:sizeField+sizeFieldLen], size); err != nil {
+				if !paxSize {
+					return nil, err
+				}
+				// the PAX record has the size
+				if err := setNumericField(blk[sizeField:sizeField+sizeFieldLen], 0); err != nil {
+					return nil, err
+				}
+			}
+			setChecksum(blk)
+			out = append(out, blk...)
+		}
+	}
+	return out, nil
+}
+
+// patchPAXSize replaces the size record of PAX extended header data, if it
+// has one, keeping the other records as they are.
+func patchPAXSize(data []byte, size int64) ([]byte, bool, error) {
+	var out []byte
+	var found bool
+	rest := string(data)
+	for len(rest) > 0 {
+		sp := strings.IndexByte(rest, ' ')
+		if sp < 0 {
+			return nil, false, tar.ErrHeader
+		}
+		n, err := strconv.Atoi(rest[:sp])
+		if err != nil || n <= sp+1 || n > len(rest) {
+			return nil, false, tar.ErrHeader
+		}
+		record := rest[:n]
+		rest = rest[n:]
+		key := record[sp+1:]
+		if eq := strings.IndexByte(key, '='); eq >= 0 {
+			key = key[:eq]
+		}
+		switch {
+		case strings.HasPrefix(key, "GNU.sparse."):
+			return nil, false, errSparseUnsupported
+		case key == "size":
+			record = formatPAXRecord(key, strconv.FormatInt(size, 10))
+			found = true
+		}
+		out = append(out, record...)
+	}
+	return out, found, nil
+}
+
+func formatPAXRecord(k, v string) string {
+	const padding = 3 // Extra padding for ' ', '=', and '\n'
+	size := len(k) + len(v) + padding
+	size += len(strconv.Itoa(size))
+	record := strconv.Itoa(size) + " " + k + "=" + v + "\n"
+
+	// Final adjustment if adding size field increased the record size.
+	if len(record) != size {
+		size = len(record)
+		record = strconv.Itoa(size) + " " + k + "=" + v + "\n"
+	}
+	return record
+}
+
+// octalDigits returns the span of the octal digits of a numeric field,
+// after any leading spaces. A field without digits spans all but its
+// terminating NUL.
+func octalDigits(field []byte) (start, end int) {
+	for start < len(field) && field[start] == ' ' {
+		start++
+	}
+	end = start
+	for end < len(field) && field[end] >= '0' && field[end] <= '7' {
+		end++
+	}
+	if start == end {
+		return 0, len(field) - 1
+	}
+	return start, end
+}
+
+func parseNumericField(field []byte) (int64, error) {
+	if field[0]&0x80 != 0 {
+		// base-256, GNU extension
+		var n int64
+		for i, b := range field {
+			if i == 0 {
+				b &= 0x7f
+			}
+			if n > (1<<55)-1 {
+				return 0, tar.ErrFieldTooLong
+			}
+			n = n<<8 | int64(b)
+		}
+		return n, nil
+	}
+	start, end := octalDigits(field)
+	digits := strings.Trim(string(field[start:end]), "\x00")
+	if digits == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(digits, 8, 64)
+}
+
+// setNumericField sets a numeric field to n, with the same formatting.
+func setNumericField(field []byte, n int64) error {
+	if field[0]&0x80 != 0 {
+		for i := len(field) - 1; i >= 0; i-- {
+			field[i] = byte(n)
+			n >>= 8
+		}
+		field[0] |= 0x80
+		return nil
+	}
+	start, end := octalDigits(field)
+	digits := strconv.FormatInt(n, 8)
+	if len(digits) > end-start {
+		return fmt.Errorf("%d does not fit in a %d digits field", n, end-start)
+	}
+	copy(field[start:end], strings.Repeat("0", end-start-len(digits))+digits)
+	return nil
+}
+
+// setChecksum sets the checksum of a header block, with the same formatting.
+func setChecksum(blk []byte) {
+	field := blk[chksumField : chksumField+chksumLen]
+	template := append([]byte(nil), field...)
+	copy(field, "        ")
+	var sum int64
+	for _, b := range blk {
+		sum += int64(b)
+	}
+	copy(field, template)
+	if setNumericField(field, sum) != nil {
+		// not enough room, use the common formatting
+		copy(field, fmt.Sprintf("%06o\x00 ", sum))
+	}
+}
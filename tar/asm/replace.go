@@ -0,0 +1,305 @@
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// ReplacePayloads writes the tar archive described by the Unpacker to w, like
+// WriteOutputTarStream, but with the payloads of the files named in
+// replacements substituted, and packs the metadata of the new archive to p.
+// The new payloads are not put to any storage.FilePutter, so the caller has
+// to keep them for reassembling the new archive.
+//
+// Every byte of the archive is kept, apart from the headers of the
+// substituted files, where only the size fields, the PAX size records and the
+// header checksums are rewritten, and the padding after their payloads. Names
+// are compared after cleaning, and it is an error if any is not found in the
+// archive, or if it is not a regular file. Archives with sparse files are not
+// supported.
+//
+// Signatures of the metadata are dropped, as they do not apply to the new
+// metadata, the storage.TrailerType entry, if any, is recomputed, and the
+// storage.PreambleType entry, if any, records the options of p instead.
+func ReplacePayloads(fg storage.FileGetter, up storage.Unpacker, replacements map[string][]byte, w io.Writer, p storage.Packer) error {
+	r := replacer{
+		fg:           fg,
+		p:            p,
+		replacements: map[string][]byte{},
+		replaced:     map[string]bool{},
+		newPadding:   -1,
+	}
+	for name, payload := range replacements {
+		r.replacements[filepath.Clean(name)] = payload
+	}
+	r.w = w
+
+	up = storage.NewZeroRunUnpacker(up)
+	for {
+		entry, err := up.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		switch entry.Type {
+		case storage.SegmentType:
+			r.run = append(r.run, *entry)
+		case storage.FileType:
+			if err := r.file(entry); err != nil {
+				return err
+			}
+		case storage.PreambleType:
+			pre, err := storage.DecodePreamble(entry)
+			if err != nil {
+				return err
+			}
+			if pre.DigestAlgorithm != "" && r.digester == nil {
+				r.digester = newStreamDigester()
+				r.w = io.MultiWriter(w, r.digester)
+			}
+			// the segments keep their kinds, but not the packer options
+			repacked, err := pre.Repacked(p).Entry()
+			if err != nil {
+				return err
+			}
+			if err := r.pack(repacked); err != nil {
+				return err
+			}
+		case storage.TrailerType:
+			if r.digester == nil {
+				return errUnannouncedTrailer(entry)
+			}
+			if err := r.end(); err != nil {
+				return err
+			}
+			if _, err := p.AddEntry(r.digester.Entry()); err != nil {
+				return err
+			}
+		case storage.SignatureType:
+			// does not apply anymore
+		default:
+			if entry.Type.Critical() {
+				return &storage.UnknownTypeError{Type: entry.Type, Position: entry.Position}
+			}
+			if _, err := p.AddEntry(*entry); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.end(); err != nil {
+		return err
+	}
+
+	var missing []string
+	for name := range r.replacements {
+		if !r.replaced[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("files to replace not found in the archive: %q", missing)
+	}
+	return nil
+}
+
+type replacer struct {
+	fg           storage.FileGetter
+	p            storage.Packer
+	w            io.Writer
+	digester     *streamDigester
+	replacements map[string][]byte
+	replaced     map[string]bool
+
+	run        []storage.Entry // SegmentType entries since the last FileType entry
+	padding    int64           // after the previous file, in the original archive
+	newPadding int64           // after the previous file if it was replaced, or -1
+}
+
+// pack packs entry, and writes its payload if it is a SegmentType entry.
+func (r *replacer) pack(entry storage.Entry) error {
+	if entry.Type == storage.SegmentType {
+		if _, err := r.w.Write(entry.Payload); err != nil {
+			return err
+		}
+	}
+	_, err := r.p.AddEntry(entry)
+	return err
+}
+
+// splitRun splits the current run of SegmentType entries into the padding of
+// the previous file, and what follows.
+func (r *replacer) splitRun() (padding, rest []byte, kinds bool, err error) {
+	var buf []byte
+	for _, e := range r.run {
+		buf = append(buf, e.Payload...)
+		kinds = kinds || e.Kind != ""
+	}
+	if int64(len(buf)) < r.padding {
+		return nil, nil, false, fmt.Errorf("expected %d bytes of padding after previous file, but only %d bytes follow", r.padding, len(buf))
+	}
+	padding, rest = buf[:r.padding], buf[r.padding:]
+	if r.newPadding >= 0 {
+		padding = make([]byte, r.newPadding)
+	}
+	return padding, rest, kinds, nil
+}
+
+// file handles a FileType entry, with the header in the current run.
+func (r *replacer) file(entry *storage.Entry) error {
+	name := filepath.Clean(entry.GetName())
+	payload, replace := r.replacements[name]
+	if replace {
+		r.replaced[name] = true
+	}
+
+	padding, raw, kinds, err := r.splitRun()
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(bytes.NewReader(raw))
+	tr.IgnoreZeros = true
+	tr.Leniency = tar.LenientChecksum
+	hdr, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("decoding the tar header of %q: %w", entry.GetName(), err)
+	}
+	nextPadding := blockPadding(hdr.Size)
+	if storage.IsSparse(hdr) {
+		if replace {
+			return fmt.Errorf("%s: %w", entry.GetName(), errSparseUnsupported)
+		}
+		nextPadding = -1
+	}
+	if replace && hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+		return fmt.Errorf("%s: only the payloads of regular files can be replaced, not of type %q", entry.GetName(), hdr.Typeflag)
+	}
+
+	if !replace && r.newPadding < 0 {
+		// unchanged
+		for _, e := range r.run {
+			if err := r.pack(e); err != nil {
+				return err
+			}
+		}
+	} else {
+		// the end of a concatenated archive, see InputOptions.IgnoreZeros
+		var entries []storage.Entry
+		if z := zeroBlocks(raw); z > 0 {
+			entries = append(entries, storage.Entry{Type: storage.SegmentType, Payload: raw[:z], Kind: storage.EndSegment})
+			raw = raw[z:]
+		}
+		if replace {
+			if raw, err = patchHeaderSize(raw, int64(len(payload))); err != nil {
+				return fmt.Errorf("rewriting the tar header of %q: %w", entry.GetName(), err)
+			}
+		}
+		entries = append(entries, storage.Entry{Type: storage.SegmentType, Payload: raw, Kind: storage.HeaderSegment})
+		if err := r.packRun(kinds, padding, entries...); err != nil {
+			return err
+		}
+	}
+	r.run = nil
+
+	if !replace {
+		r.padding, r.newPadding = nextPadding, -1
+		if nextPadding < 0 {
+			return fmt.Errorf("%s: %w", entry.GetName(), errSparseUnsupported)
+		}
+		if err := copyPayload(r.w, r.fg, entry); err != nil {
+			return err
+		}
+		_, err := r.p.AddEntry(*entry)
+		return err
+	}
+
+	r.padding, r.newPadding = nextPadding, blockPadding(int64(len(payload)))
+	var csum []byte
+	if len(payload) > 0 {
+		c := crc64.New(storage.CRCTable)
+		c.Write(payload)
+		csum = c.Sum(nil)
+	}
+	if _, err := r.w.Write(payload); err != nil {
+		return err
+	}
+	newEntry := storage.Entry{
+		Type:    storage.FileType,
+		Size:    int64(len(payload)),
+		Payload: csum,
+	}
+	newEntry.SetNameBytes(entry.GetNameBytes())
+	_, err = r.p.AddEntry(newEntry)
+	return err
+}
+
+// packRun packs the padding of the previous file, and the entries following
+// it. Without segment kinds, the padding goes with the first of them.
+func (r *replacer) packRun(kinds bool, padding []byte, entries ...storage.Entry) error {
+	if kinds {
+		if len(padding) > 0 {
+			if err := r.pack(storage.Entry{Type: storage.SegmentType, Payload: padding, Kind: storage.PaddingSegment}); err != nil {
+				return err
+			}
+		}
+	} else if len(entries) > 0 {
+		entries[0].Payload = append(padding, entries[0].Payload...)
+	}
+	for _, e := range entries {
+		if !kinds {
+			e.Kind = ""
+		}
+		if len(e.Payload) == 0 {
+			continue
+		}
+		if err := r.pack(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// end handles the last run of SegmentType entries, the end of the archive.
+func (r *replacer) end() error {
+	if r.newPadding < 0 {
+		for _, e := range r.run {
+			if err := r.pack(e); err != nil {
+				return err
+			}
+		}
+		r.run = nil
+		return nil
+	}
+
+	// the padding is replaced, the entries after it are kept
+	padding, _, kinds, err := r.splitRun()
+	if err != nil {
+		return err
+	}
+	var rest []storage.Entry
+	skip := r.padding
+	for _, e := range r.run {
+		if int64(len(e.Payload)) <= skip {
+			skip -= int64(len(e.Payload))
+			continue
+		}
+		e.Payload = e.Payload[skip:]
+		skip = 0
+		rest = append(rest, e)
+	}
+	if len(rest) == 0 {
+		rest = append(rest, storage.Entry{Type: storage.SegmentType})
+	}
+	r.run = nil
+	r.newPadding = -1
+	return r.packRun(kinds, padding, rest...)
+}
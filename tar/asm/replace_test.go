@@ -0,0 +1,154 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func TestReplacePayloads(t *testing.T) {
+	files := []testFile{
+		{tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0o755}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "etc/ca.pem", Mode: 0o644}, strings.Repeat("a", 700)},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "etc/" + strings.Repeat("long", 40), Mode: 0o644}, "hello"},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "xattrs", Mode: 0o600, PAXRecords: map[string]string{"SCHILY.xattr.user.foo": "bar"}}, strings.Repeat("x", 512)},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "last", Mode: 0o644}, "last"},
+	}
+	replacements := map[string][]byte{
+		"etc/ca.pem": []byte(strings.Repeat("b", 1100)),
+		"./xattrs":   []byte("y"),
+		"last":       nil,
+	}
+
+	for _, opts := range []InputOptions{{}, {SegmentKinds: true}} {
+		var archive, metadata bytes.Buffer
+		fgp := storage.NewBufferFileGetPutter()
+		writeTestArchive(t, files, &archive, storage.NewJSONPacker(&metadata), fgp, opts)
+
+		// the archive as it would have been written with the new payloads
+		var replaced []testFile
+		for _, f := range files {
+			for name, payload := range replacements {
+				if filepath.Clean(name) == f.hdr.Name {
+					f.body = string(payload)
+				}
+			}
+			replaced = append(replaced, f)
+		}
+		var expected, expectedMetadata bytes.Buffer
+		writeTestArchive(t, replaced, &expected, storage.NewJSONPacker(&expectedMetadata), nil, opts)
+
+		var output, newMetadata bytes.Buffer
+		err := ReplacePayloads(fgp, storage.NewJSONUnpacker(&metadata), replacements, &output, storage.NewJSONPacker(&newMetadata))
+		require.NoError(t, err, "%+v", opts)
+		assert.Equal(t, expected.Bytes(), output.Bytes(), "%+v", opts)
+		assert.Equal(t, expectedMetadata.String(), newMetadata.String(), "%+v", opts)
+
+		// the new metadata reassembles the new archive, with the new payloads
+		for name, payload := range replacements {
+			_, _, err := fgp.Put(filepath.Clean(name), bytes.NewReader(payload))
+			require.NoError(t, err)
+		}
+		var assembled bytes.Buffer
+		require.NoError(t, WriteOutputTarStream(fgp, storage.NewJSONUnpacker(&newMetadata), &assembled))
+		assert.Equal(t, output.Bytes(), assembled.Bytes(), "%+v", opts)
+	}
+}
+
+func TestReplacePayloadsNotFound(t *testing.T) {
+	var archive, metadata bytes.Buffer
+	fgp := storage.NewBufferFileGetPutter()
+	writeTestArchive(t, []testFile{
+		{tar.Header{Typeflag: tar.TypeReg, Name: "file", Mode: 0o644}, "hello"},
+	}, &archive, storage.NewJSONPacker(&metadata), fgp, InputOptions{})
+
+	err := ReplacePayloads(fgp, storage.NewJSONUnpacker(&metadata), map[string][]byte{"other": nil}, io.Discard, storage.NewJSONPacker(io.Discard))
+	assert.ErrorContains(t, err, `"other"`)
+}
+
+func TestReplacePayloadsNotRegular(t *testing.T) {
+	var archive, metadata bytes.Buffer
+	fgp := storage.NewBufferFileGetPutter()
+	writeTestArchive(t, []testFile{
+		{tar.Header{Typeflag: tar.TypeReg, Name: "file", Mode: 0o644}, "hello"},
+		{tar.Header{Typeflag: tar.TypeSymlink, Name: "l", Linkname: "file", Mode: 0o777}, ""},
+	}, &archive, storage.NewJSONPacker(&metadata), fgp, InputOptions{})
+
+	err := ReplacePayloads(fgp, storage.NewJSONUnpacker(&metadata), map[string][]byte{"l": []byte("hello")}, io.Discard, storage.NewJSONPacker(io.Discard))
+	assert.ErrorContains(t, err, "only the payloads of regular files")
+}
+
+func TestReplacePayloadsPreamble(t *testing.T) {
+	var archive, metadata bytes.Buffer
+	fgp := storage.NewBufferFileGetPutter()
+	p := storage.NewZeroRunPacker(storage.NewJSONPackerWithChecksums(&metadata))
+	writeTestArchive(t, []testFile{
+		{tar.Header{Typeflag: tar.TypeReg, Name: "file", Mode: 0o644}, "hello"},
+	}, &archive, p, fgp, InputOptions{Preamble: true})
+
+	var newMetadata bytes.Buffer
+	err := ReplacePayloads(fgp, storage.NewJSONUnpacker(&metadata), map[string][]byte{"file": []byte("bye")}, io.Discard, storage.NewJSONPacker(&newMetadata))
+	require.NoError(t, err)
+	entry, err := storage.NewJSONUnpacker(&newMetadata).Next()
+	require.NoError(t, err)
+	pre, err := storage.DecodePreamble(entry)
+	require.NoError(t, err)
+	// the options of the new packer, with the segment kinds of the archive
+	assert.Equal(t, map[string]string{"segment_kinds": "true"}, pre.Options)
+}
+
+// rawTestHeader makes a raw ustar header block.
+func rawTestHeader(name string, typeflag byte, size int64) []byte {
+	blk := make([]byte, blockSize)
+	copy(blk, name)
+	copy(blk[100:], "0000644\x00")
+	copy(blk[sizeField:], octalField(size, sizeFieldLen))
+	copy(blk[chksumField:], "000000\x00 ")
+	blk[typeflagField] = typeflag
+	copy(blk[257:], "ustar\x0000")
+	setChecksum(blk)
+	return blk
+}
+
+func octalField(n int64, width int) string {
+	s := strconv.FormatInt(n, 8)
+	return strings.Repeat("0", width-1-len(s)) + s + "\x00"
+}
+
+func TestPatchHeaderSizePAX(t *testing.T) {
+	records := formatPAXRecord("path", "file") + formatPAXRecord("size", "5") + formatPAXRecord("comment", "kept")
+	var raw []byte
+	raw = append(raw, rawTestHeader("PaxHeaders/file", tar.TypeXHeader, int64(len(records)))...)
+	raw = append(raw, records...)
+	raw = append(raw, make([]byte, blockPadding(int64(len(records))))...)
+	raw = append(raw, rawTestHeader("file", tar.TypeReg, 5)...)
+
+	payload := strings.Repeat("z", 123456)
+	patched, err := patchHeaderSize(raw, int64(len(payload)))
+	require.NoError(t, err)
+
+	tr := tar.NewReader(io.MultiReader(bytes.NewReader(patched), strings.NewReader(payload)))
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "file", hdr.Name)
+	assert.Equal(t, int64(len(payload)), hdr.Size)
+	assert.Equal(t, strconv.Itoa(len(payload)), hdr.PAXRecords["size"])
+	assert.Equal(t, "kept", hdr.PAXRecords["comment"])
+	data, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	assert.Equal(t, payload, string(data))
+}
+
+func TestPatchHeaderSizeSparse(t *testing.T) {
+	raw := rawTestHeader("sparse", tar.TypeGNUSparse, 0)
+	_, err := patchHeaderSize(raw, 1)
+	assert.ErrorIs(t, err, errSparseUnsupported)
+}
@@ -0,0 +1,84 @@
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// SalvageReport describes where and why a tar archive could not be
+// disassembled whole, see InputOptions.Salvage.
+type SalvageReport struct {
+	// Err is what stopped the archive from being read, or nil if it was read
+	// whole
+	Err error
+	// Offset in the archive of the damage: of the header that could not be
+	// read, or of where the payload of a file is cut short
+	Offset int64
+	// Position of the metadata entry of the damage: the SegmentType entry
+	// packing the bytes of the header that could not be read, or the
+	// FileType entry of the file cut short
+	Position int
+	// LastGood is the name of the last file read whole, or "" if there is
+	// none
+	LastGood string
+	// Truncated is the name of the file whose payload is cut short, if that
+	// is the damage
+	Truncated string
+}
+
+func (r *SalvageReport) String() string {
+	if r.Err == nil {
+		return "no damage"
+	}
+	s := fmt.Sprintf("damage at offset %d (entry %d): %v", r.Offset, r.Position, r.Err)
+	if r.Truncated != "" {
+		s += fmt.Sprintf(", payload of %q cut short", r.Truncated)
+	}
+	if r.LastGood != "" {
+		s += fmt.Sprintf(", last good file %q", r.LastGood)
+	}
+	return s
+}
+
+// salvageTap counts the bytes read through it, and keeps them while
+// recording, so the bytes of a header that fails to be read are not lost.
+type salvageTap struct {
+	r         io.Reader
+	n         int64
+	recording bool
+	buf       bytes.Buffer
+}
+
+func (st *salvageTap) Read(b []byte) (int, error) {
+	n, err := st.r.Read(b)
+	st.n += int64(n)
+	if st.recording {
+		st.buf.Write(b[:n])
+	}
+	return n, err
+}
+
+// record starts recording anew, or stops, keeping what was recorded.
+func (st *salvageTap) record(on bool) {
+	if on {
+		st.buf.Reset()
+	}
+	st.recording = on
+}
+
+// salvagePayload reads a payload, ending it early without error where it
+// fails to be read.
+type salvagePayload struct {
+	r   io.Reader
+	err error
+}
+
+func (sp *salvagePayload) Read(b []byte) (int, error) {
+	n, err := sp.r.Read(b)
+	if err != nil && err != io.EOF {
+		sp.err = err
+		err = io.EOF
+	}
+	return n, err
+}
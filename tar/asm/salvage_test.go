@@ -0,0 +1,106 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func TestSalvage(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, f := range []struct{ name, body string }{
+		{"a", "hello"},
+		{"b", strings.Repeat("b", 2000)},
+		{"c", "world"},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.body))}))
+		_, err := io.WriteString(tw, f.body)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	// the header of "b" is at 1024, its payload at 1536
+	corrupt := append([]byte(nil), archive.Bytes()...)
+	corrupt[1024] = 'x'
+	testCases := []struct {
+		name     string
+		input    []byte
+		expected SalvageReport
+	}{
+		{"intact", archive.Bytes(), SalvageReport{}},
+		{"truncated payload", archive.Bytes()[:2000], SalvageReport{Err: io.ErrUnexpectedEOF, Offset: 2000, LastGood: "a", Truncated: "b"}},
+		{"truncated header", archive.Bytes()[:1100], SalvageReport{Err: io.ErrUnexpectedEOF, Offset: 1024, LastGood: "a"}},
+		{"bad checksum", corrupt, SalvageReport{Err: tar.ErrHeader, Offset: 1024, LastGood: "a"}},
+	}
+	for _, tc := range testCases {
+		for _, opts := range []InputOptions{{}, {SegmentKinds: true}} {
+			var report SalvageReport
+			opts.Salvage = &report
+			var metadata bytes.Buffer
+			fgp := storage.NewBufferFileGetPutter()
+			its, err := NewInputTarStreamWithOptions(bytes.NewReader(tc.input), storage.NewJSONPacker(&metadata), fgp, opts)
+			require.NoError(t, err)
+			_, err = io.Copy(io.Discard, its)
+			require.NoError(t, err, tc.name)
+
+			assert.Equal(t, tc.expected.Err, report.Err, tc.name)
+			assert.Equal(t, tc.expected.Offset, report.Offset, tc.name)
+			assert.Equal(t, tc.expected.LastGood, report.LastGood, tc.name)
+			assert.Equal(t, tc.expected.Truncated, report.Truncated, tc.name)
+
+			// the damaged entry is where the report says
+			if report.Err != nil {
+				up := storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes()))
+				for {
+					entry, err := up.Next()
+					require.NoError(t, err, tc.name)
+					if entry.Position == report.Position {
+						if report.Truncated != "" {
+							assert.Equal(t, storage.FileType, entry.Type, tc.name)
+							assert.Equal(t, report.Truncated, entry.GetName(), tc.name)
+						} else {
+							assert.Equal(t, storage.SegmentType, entry.Type, tc.name)
+							assert.Equal(t, storage.TrailingSegment, entry.Kind, tc.name)
+						}
+						break
+					}
+				}
+			}
+
+			// the headers before the damage are still read
+			var names []string
+			require.NoError(t, IterateHeaders(storage.NewJSONUnpacker(bytes.NewReader(metadata.Bytes())), func(hdr *tar.Header) error {
+				names = append(names, hdr.Name)
+				return nil
+			}), tc.name)
+			switch {
+			case report.Err == nil:
+				assert.Equal(t, []string{"a", "b", "c"}, names, tc.name)
+			case report.Truncated != "":
+				assert.Equal(t, []string{"a", "b"}, names, tc.name)
+			default:
+				assert.Equal(t, []string{"a"}, names, tc.name)
+			}
+
+			// the exact bytes are reassembled
+			var assembled bytes.Buffer
+			require.NoError(t, WriteOutputTarStream(fgp, storage.NewJSONUnpacker(&metadata), &assembled), tc.name)
+			assert.Equal(t, tc.input, assembled.Bytes(), tc.name)
+
+			if report.Err != nil {
+				// and it is an error without salvaging
+				its, err := NewInputTarStream(bytes.NewReader(tc.input), storage.NewJSONPacker(io.Discard), nil)
+				require.NoError(t, err)
+				_, err = io.Copy(io.Discard, its)
+				assert.Error(t, err, tc.name)
+			}
+		}
+	}
+}
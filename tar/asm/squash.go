@@ -0,0 +1,145 @@
+package asm
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// Layer is the metadata of a tar archive, and the storage.FileGetter for its
+// payloads, like a layer of a container image, for SquashLayers.
+type Layer struct {
+	Unpacker   storage.Unpacker
+	FileGetter storage.FileGetter
+}
+
+// SquashLayers writes the tar archive of the files the layers add up to, in
+// order, to w, and packs its metadata to p, as a Writer with opts would.
+//
+// The files of a layer override those with the same name in the layers
+// before, along with their content unless both are directories, and the
+// AUFS-style whiteouts of a layer, see storage.ParseWhiteout, delete files
+// and the content of opaque directories from the layers before. The whiteouts
+// themselves are not written. The files are written in the order of the
+// layers, and of the archives of the layers, with their headers byte for
+// byte. A hardlink to a file that is overridden becomes a copy of it, see
+// FilterTarStream.
+//
+// A directory in more than one layer is written with the header of the last
+// of them, where that layer has it, so after the files of the layers before
+// in the directory. Consumers of the archive should not expect the header of
+// a directory to come before its content.
+//
+// The metadata of the layers is held in memory, but not their payloads.
+// Archives with sparse files or PAX global headers are not supported.
+func SquashLayers(layers []Layer, w io.Writer, p storage.Packer, opts InputOptions) error {
+	// which files are kept requires going through all the layers first
+	type source struct {
+		layer, index int
+		dir          bool
+	}
+	entries := make([][]storage.Entry, len(layers))
+	keep := make([][]bool, len(layers))
+	final := map[string]source{}
+	// the names in final as of the layers before, sorted, so that those under
+	// a directory are found by their prefix
+	var sorted []string
+	removeUnder := func(dir string, layer int) {
+		lo, hi := 0, len(sorted)
+		if dir != "" {
+			prefix := dir + "/"
+			lo = sort.SearchStrings(sorted, prefix)
+			hi = lo + sort.Search(len(sorted)-lo, func(k int) bool {
+				return !strings.HasPrefix(sorted[lo+k], prefix)
+			})
+		}
+		for _, name := range sorted[lo:hi] {
+			if s, ok := final[name]; ok && s.layer < layer {
+				delete(final, name)
+			}
+		}
+	}
+	for i, l := range layers {
+		var files []source
+		var names []string
+		var whiteouts []string
+		up := storage.NewZeroRunUnpacker(l.Unpacker)
+		for {
+			entry, err := up.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			entries[i] = append(entries[i], *entry)
+		}
+		err := iterateEntries(storage.NewEntriesUnpacker(entries[i]), func(rec *Record, _ *storage.Entry) error {
+			hdr := rec.Header
+			if hdr.Typeflag == tar.TypeXGlobalHeader {
+				return errors.New("PAX global headers are not supported")
+			}
+			name := strings.Join(splitName(hdr.Name), "/")
+			if _, _, ok := storage.ParseWhiteout(name); ok {
+				whiteouts = append(whiteouts, name)
+				name = "" // not written
+			}
+			files = append(files, source{layer: i, index: len(files), dir: hdr.Typeflag == tar.TypeDir})
+			names = append(names, name)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// the whiteouts only apply to the layers before
+		for _, wh := range whiteouts {
+			target, opaque, _ := storage.ParseWhiteout(wh)
+			if target == "." {
+				target = ""
+			}
+			if !opaque {
+				delete(final, target)
+			}
+			removeUnder(target, i)
+		}
+		for j, name := range names {
+			if name == "" {
+				continue
+			}
+			if prev, ok := final[name]; ok && prev.dir && !files[j].dir {
+				removeUnder(name, i)
+			}
+			final[name] = files[j]
+		}
+		keep[i] = make([]bool, len(files))
+		sorted = sorted[:0]
+		for name := range final {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+	}
+	for _, s := range final {
+		keep[s.layer][s.index] = true
+	}
+
+	tw, err := NewWriterWithOptions(w, p, nil, opts)
+	if err != nil {
+		return err
+	}
+	for i, l := range layers {
+		index := 0
+		err := filterEntries(tw, l.FileGetter, storage.NewEntriesUnpacker(entries[i]), func(*tar.Header) bool {
+			index++
+			return keep[i][index-1]
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,88 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func TestSquashLayers(t *testing.T) {
+	dir := func(name string) testFile {
+		return testFile{tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0o755}, ""}
+	}
+	file := func(name, body string) testFile {
+		return testFile{tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644}, body}
+	}
+	layerFiles := [][]testFile{
+		{
+			dir("etc/"), file("etc/a", "a0"), file("etc/b", "b0"),
+			dir("usr/"), file("usr/x", "x0"),
+			{tar.Header{Typeflag: tar.TypeLink, Name: "usr/xl", Linkname: "usr/x"}, ""},
+			dir("opt/"), file("opt/o1", "o1"),
+			// not in opt/, though their names start with it
+			file("opt.txt", "t0"), file("opt0", "z0"),
+			file("gone", "replaced by a directory"),
+			dir("var/"), file("var/v", "v0"),
+		},
+		{
+			file("etc/.wh.b", ""), file("etc/a", "a1"),
+			{tar.Header{Typeflag: tar.TypeDir, Name: "usr/", Mode: 0o700}, ""},
+			file("usr/x", "x1"),
+			file("opt/.wh..wh..opq", ""), file("opt/o2", "o2"),
+			dir("gone/"),
+			file("var", "replaces a directory"),
+		},
+		{
+			file("usr/y", "y2"), file(".wh.gone", ""),
+		},
+	}
+	expectedFiles := []testFile{
+		dir("etc/"),
+		// before the header of its directory, from a later layer
+		file("usr/xl", "x0"),
+		dir("opt/"),
+		file("opt.txt", "t0"),
+		file("opt0", "z0"),
+		file("etc/a", "a1"),
+		{tar.Header{Typeflag: tar.TypeDir, Name: "usr/", Mode: 0o700}, ""},
+		file("usr/x", "x1"),
+		file("opt/o2", "o2"),
+		file("var", "replaces a directory"),
+		file("usr/y", "y2"),
+	}
+
+	for _, opts := range []InputOptions{{}, {SegmentKinds: true}} {
+		var layers []Layer
+		for _, files := range layerFiles {
+			var metadata bytes.Buffer
+			fgp := storage.NewBufferFileGetPutter()
+			writeTestArchive(t, files, io.Discard, storage.NewJSONPacker(&metadata), fgp, opts)
+			layers = append(layers, Layer{Unpacker: storage.NewJSONUnpacker(&metadata), FileGetter: fgp})
+		}
+
+		var output, metadata bytes.Buffer
+		require.NoError(t, SquashLayers(layers, &output, storage.NewJSONPacker(&metadata), opts))
+
+		var expected, expectedMetadata bytes.Buffer
+		fgp := storage.NewBufferFileGetPutter()
+		writeTestArchive(t, expectedFiles, &expected, storage.NewJSONPacker(&expectedMetadata), fgp, opts)
+		assert.Equal(t, expected.Bytes(), output.Bytes(), "%+v", opts)
+		assert.Equal(t, expectedMetadata.String(), metadata.String(), "%+v", opts)
+	}
+}
+
+func TestSquashLayersGlobalHeader(t *testing.T) {
+	var metadata bytes.Buffer
+	w, err := NewWriter(io.Discard, storage.NewJSONPacker(&metadata), nil)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "hi"}}))
+	require.NoError(t, w.Close())
+
+	err = SquashLayers([]Layer{{Unpacker: storage.NewJSONUnpacker(&metadata), FileGetter: storage.NewBufferFileGetPutter()}}, io.Discard, storage.NewJSONPacker(io.Discard), InputOptions{})
+	assert.ErrorContains(t, err, "global")
+}
@@ -0,0 +1,75 @@
+package asm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// TrailerMismatchError is returned when an assembled tar archive stream does
+// not match the size and digest recorded in the storage.TrailerType entry of
+// its metadata.
+type TrailerMismatchError struct {
+	ExpectedSize   int64
+	Size           int64
+	ExpectedDigest []byte
+	Digest         []byte
+}
+
+func (e *TrailerMismatchError) Error() string {
+	if e.ExpectedSize != e.Size {
+		return fmt.Sprintf("assembled tar stream size mismatch: expected %d; got %d", e.ExpectedSize, e.Size)
+	}
+	return fmt.Sprintf("assembled tar stream digest mismatch: expected %s:%x; got %s:%x", storage.DigestAlgorithm, e.ExpectedDigest, storage.DigestAlgorithm, e.Digest)
+}
+
+// errUnannouncedTrailer is returned for a storage.TrailerType entry the
+// preamble does not announce, as the stream was not digested for it.
+func errUnannouncedTrailer(trailer *storage.Entry) error {
+	return fmt.Errorf("tar-split trailer at position %d is not announced by a preamble", trailer.Position)
+}
+
+// streamDigester accounts for the size and digest of a whole stream.
+type streamDigester struct {
+	hash hash.Hash
+	size int64
+}
+
+func newStreamDigester() *streamDigester {
+	return &streamDigester{hash: sha256.New()}
+}
+
+func (sd *streamDigester) Write(b []byte) (int, error) {
+	sd.size += int64(len(b))
+	return sd.hash.Write(b)
+}
+
+// Entry returns the storage.TrailerType entry for the stream so far.
+func (sd *streamDigester) Entry() storage.Entry {
+	return storage.Entry{
+		Type:    storage.TrailerType,
+		Name:    storage.DigestAlgorithm,
+		Size:    sd.size,
+		Payload: sd.hash.Sum(nil),
+	}
+}
+
+// Verify checks the stream so far against the storage.TrailerType entry.
+func (sd *streamDigester) Verify(trailer *storage.Entry) error {
+	if trailer.Name != storage.DigestAlgorithm {
+		return fmt.Errorf("unsupported tar-split trailer digest algorithm %q", trailer.Name)
+	}
+	actual := sd.Entry()
+	if actual.Size != trailer.Size || !bytes.Equal(actual.Payload, trailer.Payload) {
+		return &TrailerMismatchError{
+			ExpectedSize:   trailer.Size,
+			Size:           actual.Size,
+			ExpectedDigest: trailer.Payload,
+			Digest:         actual.Payload,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package asm
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// HeaderTransform modifies a tar header, for TransformHeaders.
+type HeaderTransform func(hdr *tar.Header) error
+
+// TransformHeaders writes the tar archive described by the Unpacker to w, like
+// WriteOutputTarStream, but with each header modified by transform, and packs
+// the metadata of the new archive to p, as a Writer with opts would.
+//
+// The headers left unchanged by transform are written byte for byte. The
+// others are encoded anew by the tar.Writer, in their original format if it
+// can represent them, or else in whichever format can. Transforms may not
+// change the size of files, and archives with sparse files are not supported.
+// The padding and the end of the archive are written as a tar.Writer would,
+// rather than as they were. The new metadata records the payloads under the
+// new names of the files, for a storage.FileGetter getting them by name.
+//
+// PAX global headers are kept as they are, and transform is not called for
+// them. Their records are not applied to the headers passed to transform, as
+// with IterateHeaders, see Record.HeaderWithGlobals, and they keep applying
+// to the headers of the new archive.
+func TransformHeaders(fg storage.FileGetter, up storage.Unpacker, transform HeaderTransform, w io.Writer, p storage.Packer, opts InputOptions) error {
+	tw, err := NewWriterWithOptions(w, p, nil, opts)
+	if err != nil {
+		return err
+	}
+	err = iterateEntries(up, func(rec *Record, entry *storage.Entry) error {
+		hdr := rec.Header
+		if entry == nil {
+			return fmt.Errorf("tar header for %q is not followed by a file entry", hdr.Name)
+		}
+		if storage.IsSparse(hdr) {
+			return fmt.Errorf("%s: %w", hdr.Name, errSparseUnsupported)
+		}
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			if err := tw.WriteRawHeader(rec.RawHeader, hdr); err != nil {
+				return err
+			}
+		} else {
+			newHdr := cloneHeader(hdr)
+			if err := transform(newHdr); err != nil {
+				return fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+			if newHdr.Size != hdr.Size {
+				return fmt.Errorf("%s: transform changed the size from %d to %d", hdr.Name, hdr.Size, newHdr.Size)
+			}
+			if reflect.DeepEqual(newHdr, hdr) {
+				err = tw.WriteRawHeader(rec.RawHeader, hdr)
+			} else {
+				err = writeHeaderInFormat(tw, newHdr)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+		}
+		return copyPayload(tw, fg, entry)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeHeaderInFormat writes hdr in the format it has, if any and if
+// possible, or else in any format.
+func writeHeaderInFormat(tw *Writer, hdr *tar.Header) error {
+	err := tw.WriteHeader(hdr)
+	if err == nil || hdr.Format == tar.FormatUnknown {
+		return err
+	}
+	h := *hdr
+	h.Format = tar.FormatUnknown
+	if tw.WriteHeader(&h) != nil {
+		return err
+	}
+	return nil
+}
+
+// cloneHeader returns a copy of hdr, not sharing its maps.
+func cloneHeader(hdr *tar.Header) *tar.Header {
+	c := *hdr
+	if hdr.Xattrs != nil {
+		c.Xattrs = make(map[string]string, len(hdr.Xattrs))
+		for k, v := range hdr.Xattrs {
+			c.Xattrs[k] = v
+		}
+	}
+	if hdr.PAXRecords != nil {
+		c.PAXRecords = make(map[string]string, len(hdr.PAXRecords))
+		for k, v := range hdr.PAXRecords {
+			c.PAXRecords[k] = v
+		}
+	}
+	return &c
+}
+
+// ChainTransforms returns a HeaderTransform applying each of transforms in
+// turn.
+func ChainTransforms(transforms ...HeaderTransform) HeaderTransform {
+	return func(hdr *tar.Header) error {
+		for _, t := range transforms {
+			if err := t(hdr); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ShiftIDs returns a HeaderTransform adding uidOffset and gidOffset to the
+// ownership of the files, like for mapping them to a user namespace. The
+// user and group names are kept.
+func ShiftIDs(uidOffset, gidOffset int) HeaderTransform {
+	return func(hdr *tar.Header) error {
+		uid, gid := hdr.Uid+uidOffset, hdr.Gid+gidOffset
+		if uid < 0 || gid < 0 {
+			return fmt.Errorf("shifting ownership %d:%d by %d:%d is out of range", hdr.Uid, hdr.Gid, uidOffset, gidOffset)
+		}
+		hdr.Uid, hdr.Gid = uid, gid
+		return nil
+	}
+}
+
+// ClampTimes returns a HeaderTransform setting the times of the files later
+// than t to t, like for SOURCE_DATE_EPOCH.
+func ClampTimes(t time.Time) HeaderTransform {
+	return func(hdr *tar.Header) error {
+		for _, ht := range []*time.Time{&hdr.ModTime, &hdr.AccessTime, &hdr.ChangeTime} {
+			if ht.After(t) {
+				*ht = t
+			}
+		}
+		return nil
+	}
+}
+
+// StripXattrs returns a HeaderTransform removing the extended attributes of
+// the files.
+func StripXattrs() HeaderTransform {
+	return func(hdr *tar.Header) error {
+		hdr.Xattrs = nil
+		for k := range hdr.PAXRecords {
+			if strings.HasPrefix(k, "SCHILY.xattr.") {
+				delete(hdr.PAXRecords, k)
+			}
+		}
+		return nil
+	}
+}
+
+// PrefixPaths returns a HeaderTransform moving the files under the directory
+// prefix, along with the targets of hardlinks. Symlinks are kept as they are.
+// Names with ".." elements cannot escape prefix.
+func PrefixPaths(prefix string) HeaderTransform {
+	return func(hdr *tar.Header) error {
+		hdr.Name = prefixPath(prefix, hdr.Name)
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = prefixPath(prefix, hdr.Linkname)
+		}
+		return nil
+	}
+}
+
+func prefixPath(prefix, name string) string {
+	joined := path.Join(prefix, path.Clean("/"+name))
+	if strings.HasSuffix(name, "/") {
+		joined += "/"
+	}
+	return joined
+}
@@ -0,0 +1,110 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+var transformTestFiles = []testFile{
+	{tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0o755, Uid: 0, Gid: 0}, ""},
+	{tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd", Mode: 0o644, Uid: 1, Gid: 2}, "root:x:0:0"},
+	{tar.Header{Typeflag: tar.TypeLink, Name: "etc/passwd.link", Linkname: "etc/passwd", Uid: 1, Gid: 2}, ""},
+	{tar.Header{Typeflag: tar.TypeReg, Name: "etc/" + strings.Repeat("long", 40), Mode: 0o644, Format: tar.FormatGNU}, "gnu"},
+	{tar.Header{Typeflag: tar.TypeReg, Name: "xattrs", Mode: 0o600, PAXRecords: map[string]string{"SCHILY.xattr.user.foo": "bar"}}, strings.Repeat("x", 513)},
+}
+
+func TestTransformHeadersIdentity(t *testing.T) {
+	for _, opts := range []InputOptions{{}, {SegmentKinds: true}} {
+		var archive, metadata bytes.Buffer
+		fgp := storage.NewBufferFileGetPutter()
+		writeTestArchive(t, transformTestFiles, &archive, storage.NewJSONPacker(&metadata), fgp, opts)
+		expectedMetadata := metadata.String()
+
+		var output, newMetadata bytes.Buffer
+		noop := func(*tar.Header) error { return nil }
+		require.NoError(t, TransformHeaders(fgp, storage.NewJSONUnpacker(&metadata), noop, &output, storage.NewJSONPacker(&newMetadata), opts))
+		assert.Equal(t, archive.Bytes(), output.Bytes(), "%+v", opts)
+		assert.Equal(t, expectedMetadata, newMetadata.String(), "%+v", opts)
+	}
+}
+
+func TestTransformHeaders(t *testing.T) {
+	var archive, metadata bytes.Buffer
+	fgp := storage.NewBufferFileGetPutter()
+	writeTestArchive(t, transformTestFiles, &archive, storage.NewJSONPacker(&metadata), fgp, InputOptions{})
+
+	epoch := time.Unix(1000000000, 0)
+	transform := ChainTransforms(ShiftIDs(100000, 100000), ClampTimes(epoch), StripXattrs(), PrefixPaths("rootfs"))
+	var output, newMetadata bytes.Buffer
+	require.NoError(t, TransformHeaders(fgp, storage.NewJSONUnpacker(&metadata), transform, &output, storage.NewJSONPacker(&newMetadata), InputOptions{}))
+
+	tr := tar.NewReader(bytes.NewReader(output.Bytes()))
+	for _, f := range transformTestFiles {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "rootfs/"+f.hdr.Name, hdr.Name)
+		assert.Equal(t, f.hdr.Uid+100000, hdr.Uid)
+		assert.Equal(t, f.hdr.Gid+100000, hdr.Gid)
+		assert.Equal(t, epoch, hdr.ModTime)
+		assert.Empty(t, hdr.PAXRecords["SCHILY.xattr.user.foo"])
+		if f.hdr.Typeflag == tar.TypeLink {
+			assert.Equal(t, "rootfs/"+f.hdr.Linkname, hdr.Linkname)
+		}
+		if f.hdr.Format == tar.FormatGNU {
+			assert.Equal(t, tar.FormatGNU, hdr.Format, "the original format is kept")
+		}
+		body, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		assert.Equal(t, f.body, string(body))
+	}
+	_, err := tr.Next()
+	assert.Equal(t, io.EOF, err)
+
+	// the new metadata reassembles the new archive, with the payloads under
+	// their new names
+	for _, f := range transformTestFiles {
+		_, _, err := fgp.Put("rootfs/"+f.hdr.Name, strings.NewReader(f.body))
+		require.NoError(t, err)
+	}
+	var assembled bytes.Buffer
+	require.NoError(t, WriteOutputTarStream(fgp, storage.NewJSONUnpacker(&newMetadata), &assembled))
+	assert.Equal(t, output.Bytes(), assembled.Bytes())
+}
+
+func TestTransformHeadersErrors(t *testing.T) {
+	var metadata bytes.Buffer
+	fgp := storage.NewBufferFileGetPutter()
+	writeTestArchive(t, transformTestFiles, io.Discard, storage.NewJSONPacker(&metadata), fgp, InputOptions{})
+	m := metadata.String()
+
+	err := TransformHeaders(fgp, storage.NewJSONUnpacker(strings.NewReader(m)), ShiftIDs(-2, 0), io.Discard, storage.NewJSONPacker(io.Discard), InputOptions{})
+	assert.ErrorContains(t, err, "out of range")
+
+	grow := func(hdr *tar.Header) error {
+		hdr.Size++
+		return nil
+	}
+	err = TransformHeaders(fgp, storage.NewJSONUnpacker(strings.NewReader(m)), grow, io.Discard, storage.NewJSONPacker(io.Discard), InputOptions{})
+	assert.ErrorContains(t, err, "changed the size")
+}
+
+func TestPrefixPaths(t *testing.T) {
+	for name, expected := range map[string]string{
+		"a/b":        "p/a/b",
+		"./a/":       "p/a/",
+		"/abs":       "p/abs",
+		"../../evil": "p/evil",
+	} {
+		hdr := &tar.Header{Name: name}
+		require.NoError(t, PrefixPaths("p")(hdr))
+		assert.Equal(t, expected, hdr.Name, name)
+	}
+}
@@ -0,0 +1,221 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+// Writer writes a tar archive like a tar.Writer, and packs its metadata to a
+// storage.Packer as it goes, the way NewInputTarStream would from reading the
+// archive. It saves building an archive, and then reading it back to
+// disassemble it.
+type Writer struct {
+	tw       *tar.Writer
+	rec      *rawRecorder
+	p        storage.Packer
+	fp       storage.FilePutter
+	opts     InputOptions
+	digester *streamDigester
+	file     *pendingFile
+}
+
+// pendingFile is the file whose payload is being written, and put to the
+// storage.FilePutter.
+type pendingFile struct {
+	name string
+	size int64
+	pw   *io.PipeWriter
+	done chan putResult
+}
+
+type putResult struct {
+	csum []byte
+	err  error
+}
+
+// rawRecorder records the raw bytes written by the tar.Writer, apart from the
+// payloads of the files, which are passed on to the storage.FilePutter.
+type rawRecorder struct {
+	w    io.Writer
+	raw  bytes.Buffer
+	data io.Writer // of the current file, or nil outside of payloads
+}
+
+func (rr *rawRecorder) Write(b []byte) (int, error) {
+	n, err := rr.w.Write(b)
+	if rr.data != nil {
+		if _, err := rr.data.Write(b[:n]); err != nil {
+			return n, err
+		}
+	} else {
+		rr.raw.Write(b[:n])
+	}
+	return n, err
+}
+
+// NewWriter returns a Writer writing the tar archive to w, and packing its
+// metadata to p. The payloads of the files are stashed to fp, which may be
+// nil if that is not needed, like for NewInputTarStream.
+func NewWriter(w io.Writer, p storage.Packer, fp storage.FilePutter) (*Writer, error) {
+	return NewWriterWithOptions(w, p, fp, InputOptions{})
+}
+
+// NewWriterWithOptions is NewWriter, with options.
+func NewWriterWithOptions(w io.Writer, p storage.Packer, fp storage.FilePutter, opts InputOptions) (*Writer, error) {
+	if fp == nil {
+		fp = storage.NewDiscardFilePutter()
+	}
+	opts = opts.forPacker(p)
+	if err := packPreamble(p, opts); err != nil {
+		return nil, err
+	}
+	var digester *streamDigester
+	if opts.Trailer {
+		digester = newStreamDigester()
+		w = io.MultiWriter(w, digester)
+	}
+	rec := &rawRecorder{w: w}
+	return &Writer{
+		tw:       tar.NewWriter(rec),
+		rec:      rec,
+		p:        p,
+		fp:       fp,
+		opts:     opts,
+		digester: digester,
+	}, nil
+}
+
+// WriteHeader writes hdr and prepares to accept the file's contents, like
+// tar.Writer.WriteHeader.
+func (w *Writer) WriteHeader(hdr *tar.Header) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	return w.startFile(hdr)
+}
+
+// WriteRawHeader writes the raw bytes of a header, including any extended
+// headers, like the RawHeader of a Record, and prepares to accept the
+// contents of the file hdr describes, hdr being what raw decodes to. It
+// keeps headers byte for byte, where WriteHeader would encode them anew.
+// Sparse files are not supported.
+func (w *Writer) WriteRawHeader(raw []byte, hdr *tar.Header) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := w.tw.WriteRawHeader(raw, hdr); err != nil {
+		return err
+	}
+	return w.startFile(hdr)
+}
+
+// startFile packs the header just written, and prepares to accept the
+// contents of the file.
+func (w *Writer) startFile(hdr *tar.Header) error {
+	if err := w.addSegment(storage.HeaderSegment); err != nil {
+		return err
+	}
+
+	if hdr.Size <= 0 {
+		return w.addFile(hdr.Name, hdr.Size, nil)
+	}
+	pr, pw := io.Pipe()
+	file := &pendingFile{
+		name: hdr.Name,
+		size: hdr.Size,
+		pw:   pw,
+		done: make(chan putResult, 1),
+	}
+	go func() {
+		_, csum, err := w.fp.Put(file.name, pr)
+		pr.CloseWithError(err)
+		file.done <- putResult{csum: csum, err: err}
+	}()
+	w.file = file
+	w.rec.data = pw
+	return nil
+}
+
+// Write writes to the current file in the tar archive, like tar.Writer.Write.
+func (w *Writer) Write(b []byte) (int, error) {
+	return w.tw.Write(b)
+}
+
+// Flush finishes writing the current file, with its padding, like
+// tar.Writer.Flush.
+func (w *Writer) Flush() error {
+	file := w.file
+	w.file = nil
+	w.rec.data = nil
+	var flushErr error
+	if file != nil {
+		// complete the payload first, for the FilePutter to finish
+		flushErr = w.tw.Flush()
+		file.pw.Close()
+		res := <-file.done
+		if flushErr == nil && res.err != nil {
+			flushErr = res.err
+		}
+		if flushErr == nil {
+			flushErr = w.addFile(file.name, file.size, res.csum)
+		}
+	} else {
+		flushErr = w.tw.Flush()
+	}
+	if flushErr != nil {
+		return flushErr
+	}
+	if w.opts.SegmentKinds {
+		return w.addSegment(storage.PaddingSegment)
+	}
+	// without segment kinds, the padding is packed with the next header
+	return nil
+}
+
+// Close finishes the tar archive, and packs the end of its metadata. It does
+// not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if err := w.addSegment(storage.EndSegment); err != nil {
+		return err
+	}
+	if w.digester == nil {
+		return nil
+	}
+	_, err := w.p.AddEntry(w.digester.Entry())
+	return err
+}
+
+// addSegment packs the raw bytes written since the last call.
+func (w *Writer) addSegment(kind storage.SegmentKind) error {
+	if !w.opts.SegmentKinds {
+		kind = ""
+	}
+	// the Packer may keep the payload
+	err := addRawSegment(w.p, kind, append([]byte(nil), w.rec.raw.Bytes()...))
+	w.rec.raw.Reset()
+	return err
+}
+
+func (w *Writer) addFile(name string, size int64, csum []byte) error {
+	entry := storage.Entry{
+		Type:    storage.FileType,
+		Size:    size,
+		Payload: csum,
+	}
+	// For proper marshalling of non-utf8 characters
+	entry.SetName(name)
+	_, err := w.p.AddEntry(entry)
+	return err
+}
@@ -0,0 +1,65 @@
+package asm
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vbatts/tar-split/archive/tar"
+	"github.com/vbatts/tar-split/tar/storage"
+)
+
+func TestWriter(t *testing.T) {
+	files := []struct {
+		hdr  tar.Header
+		body string
+	}{
+		{tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0o755}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "dir/empty", Mode: 0o644}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "dir/file", Mode: 0o644}, "hello"},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "dir/" + strings.Repeat("long", 40), Mode: 0o644}, strings.Repeat("x", 1024)},
+		{tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "dir/file"}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "xattrs", Mode: 0o600, PAXRecords: map[string]string{"SCHILY.xattr.user.foo": "bar"}}, strings.Repeat("y", 513)},
+	}
+
+	for _, opts := range []InputOptions{{}, {SegmentKinds: true}} {
+		var archive, metadata bytes.Buffer
+		fgp := storage.NewBufferFileGetPutter()
+		w, err := NewWriterWithOptions(&archive, storage.NewJSONPacker(&metadata), fgp, opts)
+		require.NoError(t, err)
+		for _, f := range files {
+			hdr := f.hdr
+			hdr.Size = int64(len(f.body))
+			hdr.ModTime = time.Unix(1500000000, 0)
+			require.NoError(t, w.WriteHeader(&hdr))
+			_, err := io.WriteString(w, f.body)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+
+		// the metadata is what disassembling the archive packs
+		var expected bytes.Buffer
+		its, err := NewInputTarStreamWithOptions(bytes.NewReader(archive.Bytes()), storage.NewJSONPacker(&expected), nil, opts)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, its)
+		require.NoError(t, err)
+		assert.Equal(t, expected.String(), metadata.String(), "%+v", opts)
+
+		var assembled bytes.Buffer
+		require.NoError(t, WriteOutputTarStream(fgp, storage.NewJSONUnpacker(&metadata), &assembled))
+		assert.Equal(t, archive.Bytes(), assembled.Bytes(), "%+v", opts)
+	}
+}
+
+func TestWriterMissingData(t *testing.T) {
+	w, err := NewWriter(io.Discard, storage.NewJSONPacker(io.Discard), nil)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "short", Size: 10}))
+	_, err = w.Write([]byte("short"))
+	require.NoError(t, err)
+	assert.Error(t, w.Close())
+}
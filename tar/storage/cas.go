@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrChecksumCollision occurs when a payload is stored to a content-addressed
+// FilePutter, and a different payload with the same checksum is already
+// stored.
+var ErrChecksumCollision = errors.New("payload checksum collides with a stored payload")
+
+// ChecksumFileGetter is the interface for getting a stream of a file payload,
+// addressed by the crc64 checksum recorded in the Payload of its FileType
+// Entry, rather than by name.
+type ChecksumFileGetter interface {
+	// GetByChecksum returns a stream for the payload with the provided checksum
+	GetByChecksum(checksum []byte) (output io.ReadCloser, err error)
+}
+
+// CASFileGetPutter is a FileGetPutter that can also get payloads by their
+// checksum.
+type CASFileGetPutter interface {
+	FileGetPutter
+	ChecksumFileGetter
+}
+
+// NewCASFileGetPutter returns a content-addressed FileGetPutter, storing the
+// payloads in the directory root, which is created if needed.
+//
+// Payloads are stored by their crc64 checksum, in subdirectories named after
+// the first byte of the checksum, so identical payloads are only stored once,
+// even when Put under different names or from different archives. Since this
+// is the checksum recorded in the metadata, the same directory can be shared
+// across many archives, and asm.WriteOutputTarStream fetches the payloads by
+// checksum. A payload colliding with a different stored one, compared byte for
+// byte, is refused with ErrChecksumCollision.
+//
+// Getting a payload by name is only possible for the names Put to the
+// returned FileGetPutter.
+func NewCASFileGetPutter(root string) (CASFileGetPutter, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &casFileGetPutter{
+		root:  root,
+		names: map[string][]byte{},
+	}, nil
+}
+
+type casFileGetPutter struct {
+	root string
+
+	mu    sync.Mutex
+	names map[string][]byte // checksums of the payloads Put, by name
+}
+
+func (cfgp *casFileGetPutter) path(checksum []byte) string {
+	sum := hex.EncodeToString(checksum)
+	if len(sum) < 2 {
+		return filepath.Join(cfgp.root, sum)
+	}
+	return filepath.Join(cfgp.root, sum[:2], sum)
+}
+
+func (cfgp *casFileGetPutter) Get(name string) (io.ReadCloser, error) {
+	cfgp.mu.Lock()
+	checksum, ok := cfgp.names[name]
+	cfgp.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no such file %q", name)
+	}
+	return cfgp.GetByChecksum(checksum)
+}
+
+func (cfgp *casFileGetPutter) GetByChecksum(checksum []byte) (io.ReadCloser, error) {
+	return os.Open(cfgp.path(checksum))
+}
+
+func (cfgp *casFileGetPutter) Put(name string, r io.Reader) (int64, []byte, error) {
+	tmp, err := os.CreateTemp(cfgp.root, ".put-")
+	if err != nil {
+		return 0, nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	crc := crc64.New(CRCTable)
+	i, err := io.Copy(io.MultiWriter(tmp, crc), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	checksum := crc.Sum(nil)
+
+	dest := cfgp.path(checksum)
+	if fi, err := os.Stat(dest); err == nil {
+		// already stored, but be sure it is the same payload, as crc64
+		// collisions are easily made
+		same := fi.Size() == i
+		if same {
+			if same, err = sameFile(tmp.Name(), dest); err != nil {
+				return 0, nil, err
+			}
+		}
+		if !same {
+			return 0, nil, fmt.Errorf("%w: %q", ErrChecksumCollision, name)
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return 0, nil, err
+		}
+		if err := os.Rename(tmp.Name(), dest); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	cfgp.mu.Lock()
+	cfgp.names[name] = checksum
+	cfgp.mu.Unlock()
+	return i, checksum, nil
+}
+
+// sameFile reports whether the files at the paths a and b have the same
+// contents.
+func sameFile(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufa := make([]byte, 32*1024)
+	bufb := make([]byte, len(bufa))
+	for {
+		na, erra := io.ReadFull(fa, bufa)
+		nb, errb := io.ReadFull(fb, bufb)
+		if !bytes.Equal(bufa[:na], bufb[:nb]) {
+			return false, nil
+		}
+		switch {
+		case erra == io.EOF || erra == io.ErrUnexpectedEOF:
+			return errb == io.EOF || errb == io.ErrUnexpectedEOF, nil
+		case erra != nil:
+			return false, erra
+		case errb != nil && errb != io.EOF && errb != io.ErrUnexpectedEOF:
+			return false, errb
+		}
+	}
+}
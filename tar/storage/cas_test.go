@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCASFileGetPutter(t *testing.T) {
+	root := t.TempDir()
+	cfgp, err := NewCASFileGetPutter(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"file1.txt":     "foo",
+		"file2.txt":     "bar",
+		"dup/file1.txt": "foo",
+	}
+	sums := map[string][]byte{}
+	for n, body := range files {
+		i, csum, err := cfgp.Put(n, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i != int64(len(body)) {
+			t.Errorf("size %q: expected %d; got %d", n, len(body), i)
+		}
+		sums[n] = csum
+	}
+	if !bytes.Equal(sums["file1.txt"], []byte{60, 60, 48, 48, 0, 0, 0, 0}) {
+		t.Errorf("checksum: got 0x%x", sums["file1.txt"])
+	}
+
+	// identical payloads are only stored once
+	var stored int
+	err = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			stored++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != 2 {
+		t.Errorf("expected 2 stored payloads, got %d", stored)
+	}
+
+	for n, body := range files {
+		for _, get := range []func() (io.ReadCloser, error){
+			func() (io.ReadCloser, error) { return cfgp.Get(n) },
+			func() (io.ReadCloser, error) { return cfgp.GetByChecksum(sums[n]) },
+		} {
+			r, err := get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body != string(buf) {
+				t.Errorf("expected %q, got %q", body, string(buf))
+			}
+		}
+	}
+
+	// a fresh FileGetPutter on the same root can only get by checksum
+	cfgp2, err := NewCASFileGetPutter(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfgp2.Get("file2.txt"); err == nil {
+		t.Error("expected getting an unknown name to fail")
+	}
+	r, err := cfgp2.GetByChecksum(sums["file2.txt"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+}
+
+func TestCASFileGetPutterCollision(t *testing.T) {
+	root := t.TempDir()
+	cfgp, err := NewCASFileGetPutter(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, csum, err := cfgp.Put("file1.txt", bytes.NewBufferString("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fake a different payload already stored with the same checksum
+	if err := os.WriteFile(cfgp.(*casFileGetPutter).path(csum), []byte("foofoo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cfgp.Put("file2.txt", bytes.NewBufferString("foo")); !errors.Is(err, ErrChecksumCollision) {
+		t.Errorf("expected ErrChecksumCollision, got %v", err)
+	}
+
+	// and one of the same size
+	if err := os.WriteFile(cfgp.(*casFileGetPutter).path(csum), []byte("bar"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cfgp.Put("file3.txt", bytes.NewBufferString("foo")); !errors.Is(err, ErrChecksumCollision) {
+		t.Errorf("expected ErrChecksumCollision for a payload of the same size, got %v", err)
+	}
+
+	// while the very same payload is fine
+	if err := os.WriteFile(cfgp.(*casFileGetPutter).path(csum), []byte("foo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cfgp.Put("file4.txt", bytes.NewBufferString("foo")); err != nil {
+		t.Errorf("expected the same payload to be stored once, got %v", err)
+	}
+}
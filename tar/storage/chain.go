@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"strings"
+)
+
+// ChainFileGetter is a FileGetter that tries several FileGetters in order,
+// for payloads that are spread across several locations, like a local cache
+// and an extracted root filesystem.
+type ChainFileGetter struct {
+	// Getters are tried in order, and the first one providing the payload
+	// serves it.
+	Getters []FileGetter
+
+	// Verify the size and checksum of a candidate payload before accepting
+	// it, and try the next FileGetter if they do not match. This is only
+	// possible when getting the payload for an Entry, and reads the payload
+	// twice.
+	Verify bool
+
+	// Served, if set, is called with the name of each payload served and the
+	// index in Getters of the FileGetter that served it.
+	Served func(name string, index int)
+}
+
+// NewChainFileGetter returns a ChainFileGetter trying getters in order.
+func NewChainFileGetter(getters ...FileGetter) *ChainFileGetter {
+	return &ChainFileGetter{Getters: getters}
+}
+
+// ChainError is returned when none of the FileGetters of a ChainFileGetter
+// could serve a payload. It holds the error of each of them, in order.
+type ChainError struct {
+	Name string
+	Errs []error
+}
+
+func (ce *ChainError) Error() string {
+	msgs := make([]string, len(ce.Errs))
+	for i, err := range ce.Errs {
+		msgs[i] = fmt.Sprintf("[%d] %v", i, err)
+	}
+	return fmt.Sprintf("no source for %q: %s", ce.Name, strings.Join(msgs, "; "))
+}
+
+// Get returns the payload from the first FileGetter providing filename.
+func (cfg *ChainFileGetter) Get(filename string) (io.ReadCloser, error) {
+	ce := &ChainError{Name: filename}
+	for i, fg := range cfg.Getters {
+		rc, err := fg.Get(filename)
+		if err != nil {
+			ce.Errs = append(ce.Errs, err)
+			continue
+		}
+		cfg.served(filename, i)
+		return rc, nil
+	}
+	return nil, ce
+}
+
+// GetEntry returns the payload of entry from the first FileGetter providing
+// it, verifying it first if cfg.Verify is set.
+func (cfg *ChainFileGetter) GetEntry(entry *Entry) (io.ReadCloser, error) {
+	ce := &ChainError{Name: entry.GetName()}
+	for i, fg := range cfg.Getters {
+		if cfg.Verify {
+			if err := verifyPayload(fg, entry); err != nil {
+				ce.Errs = append(ce.Errs, err)
+				continue
+			}
+		}
+		rc, err := GetPayload(fg, entry)
+		if err != nil {
+			ce.Errs = append(ce.Errs, err)
+			continue
+		}
+		cfg.served(entry.GetName(), i)
+		return rc, nil
+	}
+	return nil, ce
+}
+
+func (cfg *ChainFileGetter) served(name string, index int) {
+	if cfg.Served != nil {
+		cfg.Served(name, index)
+	}
+}
+
+func verifyPayload(fg FileGetter, entry *Entry) error {
+	rc, err := GetPayload(fg, entry)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	crc := crc64.New(CRCTable)
+	n, err := io.Copy(crc, rc)
+	if err != nil {
+		return err
+	}
+	if n != entry.Size {
+		return fmt.Errorf("size mismatch for %q: expected %d; got %d", entry.GetName(), entry.Size, n)
+	}
+	if !bytes.Equal(crc.Sum(nil), entry.Payload) {
+		return fmt.Errorf("file integrity checksum failed for %q", entry.GetName())
+	}
+	return nil
+}
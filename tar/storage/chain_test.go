@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestChainFileGetter(t *testing.T) {
+	cache := NewBufferFileGetPutter()
+	rootfs := NewBufferFileGetPutter()
+	if _, _, err := cache.Put("file1.txt", bytes.NewBufferString("foo")); err != nil {
+		t.Fatal(err)
+	}
+	// stale copy in the cache, the rootfs has the right one
+	if _, _, err := cache.Put("file2.txt", bytes.NewBufferString("baz")); err != nil {
+		t.Fatal(err)
+	}
+	_, file2Sum, err := rootfs.Put("file2.txt", bytes.NewBufferString("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := map[string]int{}
+	cfg := NewChainFileGetter(cache, rootfs)
+	cfg.Served = func(name string, index int) { served[name] = index }
+
+	get := func(rc io.ReadCloser, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		buf, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf)
+	}
+
+	if got := get(cfg.Get("file1.txt")); got != "foo" || served["file1.txt"] != 0 {
+		t.Errorf("file1.txt: got %q from %d", got, served["file1.txt"])
+	}
+	if got := get(cfg.Get("file2.txt")); got != "baz" || served["file2.txt"] != 0 {
+		t.Errorf("file2.txt: got %q from %d", got, served["file2.txt"])
+	}
+
+	entry := &Entry{Type: FileType, Name: "file2.txt", Size: 3, Payload: file2Sum}
+	if got := get(cfg.GetEntry(entry)); got != "baz" || served["file2.txt"] != 0 {
+		t.Errorf("file2.txt: got %q from %d without verification", got, served["file2.txt"])
+	}
+	cfg.Verify = true
+	if got := get(cfg.GetEntry(entry)); got != "bar" || served["file2.txt"] != 1 {
+		t.Errorf("file2.txt: got %q from %d with verification", got, served["file2.txt"])
+	}
+
+	_, err = cfg.Get("file3.txt")
+	var ce *ChainError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected a ChainError, got %v", err)
+	}
+	if len(ce.Errs) != 2 {
+		t.Errorf("expected an error per FileGetter, got %v", ce.Errs)
+	}
+}
@@ -7,6 +7,8 @@ an entry marking a file payload.
 
 The raw bytes are stored precisely in the packed (marshalled) Entry, whereas
 the file payload marker include the name of the file, size, and crc64 checksum
-(for basic file integrity).
+(for basic file integrity). Segments may record their kind, separating the
+headers from the padding. A trailer at the end of the stream records the size
+and digest of the whole archive.
 */
 package storage
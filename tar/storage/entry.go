@@ -1,6 +1,10 @@
 package storage
 
-import "unicode/utf8"
+import (
+	"fmt"
+	"sync"
+	"unicode/utf8"
+)
 
 // Entries is for sorting by Position
 type Entries []Entry
@@ -23,8 +27,147 @@ const (
 	//
 	// Its payload is to be marshalled base64 encoded.
 	SegmentType
+	// ZeroSegmentType represents a raw bytes segment made only of zero bytes,
+	// like the padding of the archive, stored as its length. It is only found
+	// in packed streams: the Unpackers expand it to the equivalent
+	// SegmentType, see NewZeroRunPacker.
+	//
+	// Its Size is the number of zero bytes, and it has no Payload.
+	ZeroSegmentType
 )
 
+// Types of metadata about the stream, which consumers may skip.
+const (
+	// TrailerType represents the end of the archive stream, recording the
+	// size and digest of the whole stream, for verifying the reassembled
+	// stream.
+	//
+	// Its Size is the length of the stream, its Name the digest algorithm (see
+	// DigestAlgorithm) and its Payload the digest.
+	TrailerType = IgnorableTypeFlag | 2
+	// PreambleType represents the description of the metadata stream itself,
+	// as its leading entry. See Preamble.
+	//
+	// Its payload is the Preamble, json encoded.
+	PreambleType = IgnorableTypeFlag | 3
+)
+
+// IgnorableTypeFlag is set in the value of the Types that consumers not
+// knowing them can safely skip. Entries of unknown Types without it are
+// critical: the stream cannot be processed correctly without understanding
+// them, so consumers must fail on them.
+const IgnorableTypeFlag Type = 1 << 8
+
+var builtinTypes = map[Type]string{
+	FileType:        "file",
+	SegmentType:     "segment",
+	TrailerType:     "trailer",
+	PreambleType:    "preamble",
+	ZeroSegmentType: "zero-segment",
+	SignatureType:   "signature",
+}
+
+var (
+	typesMu         sync.RWMutex
+	registeredTypes = map[Type]string{}
+)
+
+// RegisterType registers a custom Type, with a name for display. Registered
+// Types are known to the Unpackers, and are passed to the consumers, which
+// skip them if they are ignorable, or fail otherwise, unless they handle them.
+// Registering a critical Type only lets it through the Unpackers: the
+// consumers of this module, like asm.WriteOutputTarStream and
+// asm.IterateHeaders, do not handle custom Types, so they still fail on it
+// with an *UnknownTypeError.
+//
+// Custom Types should have IgnorableTypeFlag set, unless a stream with them
+// cannot be assembled correctly without processing them.
+func RegisterType(t Type, name string) error {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	if _, ok := builtinTypes[t]; ok {
+		return fmt.Errorf("tar-split entry type %d is builtin", int(t))
+	}
+	if n, ok := registeredTypes[t]; ok {
+		return fmt.Errorf("tar-split entry type %d is already registered as %q", int(t), n)
+	}
+	registeredTypes[t] = name
+	return nil
+}
+
+func (t Type) name() (string, bool) {
+	if n, ok := builtinTypes[t]; ok {
+		return n, true
+	}
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	n, ok := registeredTypes[t]
+	return n, ok
+}
+
+// Known reports whether t is a builtin or registered Type.
+func (t Type) Known() bool {
+	_, ok := t.name()
+	return ok
+}
+
+// Critical reports whether entries of Type t must not be skipped by consumers
+// not handling them.
+func (t Type) Critical() bool {
+	return t&IgnorableTypeFlag == 0
+}
+
+func (t Type) String() string {
+	if n, ok := t.name(); ok {
+		return n
+	}
+	return fmt.Sprintf("unknown(%d)", int(t))
+}
+
+// UnknownTypeError is returned for an entry of a critical Type, that is not
+// handled by the consumer.
+type UnknownTypeError struct {
+	Type     Type
+	Position int
+}
+
+func (e *UnknownTypeError) Error() string {
+	return fmt.Sprintf("unsupported critical tar-split entry type %s at position %d", e.Type, e.Position)
+}
+
+// CheckType returns an *UnknownTypeError if e has a critical Type that is
+// neither builtin nor registered, as no consumer could process it. Unpackers
+// check each entry with it.
+func CheckType(e *Entry) error {
+	if e.Type.Critical() && !e.Type.Known() {
+		return &UnknownTypeError{Type: e.Type, Position: e.Position}
+	}
+	return nil
+}
+
+// SegmentKind is the part of the archive stream the raw bytes of a SegmentType
+// entry are from. Streams from NewInputTarStream without segment kinds mix the
+// padding of a file with the following header in one SegmentType entry, which
+// has no kind.
+type SegmentKind string
+
+const (
+	// HeaderSegment is the tar header of a file, with any extended headers
+	// (PAX, GNU long names and sparse maps) preceding or following it.
+	HeaderSegment SegmentKind = "header"
+	// PaddingSegment is the padding after the data of a file, up to the next
+	// block.
+	PaddingSegment SegmentKind = "padding"
+	// EndSegment is the end-of-archive marker, normally two zero blocks.
+	EndSegment SegmentKind = "end"
+	// TrailingSegment is the rest of the stream after the end-of-archive
+	// marker, normally more zero blocks.
+	TrailingSegment SegmentKind = "trailing"
+)
+
+// DigestAlgorithm is the digest algorithm recorded in TrailerType entries.
+const DigestAlgorithm = "sha256"
+
 // Entry is the structure for packing and unpacking the information read from
 // the Tar archive.
 //
@@ -39,6 +182,14 @@ type Entry struct {
 	Size     int64  `json:"size,omitempty"`
 	Payload  []byte `json:"payload"` // SegmentType stores payload here; FileType stores crc64 checksum here;
 	Position int    `json:"position"`
+
+	// Kind of a SegmentType entry, if the stream records it
+	Kind SegmentKind `json:"kind,omitempty"`
+
+	// Checksum and Chain protect the integrity of the packed Entry, if the
+	// Packer records them. See NewJSONPackerWithChecksums.
+	Checksum []byte `json:"checksum,omitempty"`
+	Chain    []byte `json:"chain,omitempty"`
 }
 
 // SetName will check name for valid UTF-8 string, and set the appropriate
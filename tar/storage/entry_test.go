@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"sort"
 	"testing"
 )
@@ -93,3 +95,59 @@ func TestFileRaw(t *testing.T) {
 		t.Errorf("expected Position %q, got %q", f.Position, f1.Position)
 	}
 }
+
+func TestTypes(t *testing.T) {
+	for _, typ := range []Type{FileType, SegmentType, ZeroSegmentType} {
+		if !typ.Known() || !typ.Critical() {
+			t.Errorf("%s: expected a known critical type", typ)
+		}
+	}
+	for _, typ := range []Type{TrailerType, PreambleType, SignatureType} {
+		if !typ.Known() || typ.Critical() {
+			t.Errorf("%s: expected a known ignorable type", typ)
+		}
+	}
+
+	custom := IgnorableTypeFlag | 0x80
+	if custom.Known() || custom.Critical() {
+		t.Errorf("%s: expected an unknown ignorable type", custom)
+	}
+	if err := RegisterType(custom, "custom"); err != nil {
+		t.Fatal(err)
+	}
+	if !custom.Known() || custom.String() != "custom" {
+		t.Errorf("%s: expected a known type", custom)
+	}
+	if err := RegisterType(custom, "again"); err == nil {
+		t.Error("expected registering a type twice to fail")
+	}
+	if err := RegisterType(FileType, "file"); err == nil {
+		t.Error("expected registering a builtin type to fail")
+	}
+}
+
+func TestUnknownTypes(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	jp := NewJSONPacker(buf)
+	for _, e := range []Entry{
+		{Type: SegmentType, Payload: []byte("how")},
+		{Type: IgnorableTypeFlag | 2, Payload: []byte("y'all")},
+		{Type: 42, Payload: []byte("doin")},
+	} {
+		if _, err := jp.AddEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jup := NewJSONUnpacker(buf)
+	for i := 0; i < 2; i++ {
+		if _, err := jup.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := jup.Next()
+	var ute *UnknownTypeError
+	if !errors.As(err, &ute) || ute.Type != 42 || ute.Position != 2 {
+		t.Errorf("expected an UnknownTypeError at position 2, got %v", err)
+	}
+}
@@ -17,6 +17,25 @@ type FileGetter interface {
 	Get(filename string) (output io.ReadCloser, err error)
 }
 
+// EntryFileGetter is the interface for getting a stream of a file payload,
+// given its FileType Entry, so that both its name and its checksum are known.
+type EntryFileGetter interface {
+	// GetEntry returns a stream for the payload of the provided Entry
+	GetEntry(entry *Entry) (output io.ReadCloser, err error)
+}
+
+// GetPayload gets the payload of a FileType entry from fg, using the most
+// specific way fg supports: by Entry, by checksum, or by name.
+func GetPayload(fg FileGetter, entry *Entry) (io.ReadCloser, error) {
+	switch g := fg.(type) {
+	case EntryFileGetter:
+		return g.GetEntry(entry)
+	case ChecksumFileGetter:
+		return g.GetByChecksum(entry.Payload)
+	}
+	return fg.Get(entry.GetName())
+}
+
 // FilePutter is the interface for storing a stream of a file payload,
 // addressed by name/filename.
 type FilePutter interface {
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash/crc64"
+)
+
+// CorruptEntryError is returned by an Unpacker for an Entry failing its
+// integrity checks.
+type CorruptEntryError struct {
+	// Position of the Entry in the stream, counting from 0
+	Position int
+	Reason   string
+}
+
+func (e *CorruptEntryError) Error() string {
+	return fmt.Sprintf("corrupt tar-split entry at position %d: %s", e.Position, e.Reason)
+}
+
+// entryChecksum returns the crc64 checksum of the json encoding of e, apart
+// from its integrity fields.
+func entryChecksum(e Entry) ([]byte, error) {
+	e.Checksum, e.Chain = nil, nil
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	c := crc64.New(CRCTable)
+	c.Write(buf)
+	return c.Sum(nil), nil
+}
+
+// nextChain returns the hash chaining an Entry's checksum to the previous
+// Entries.
+func nextChain(prev, checksum []byte) []byte {
+	h := sha256.New()
+	h.Write(prev)
+	h.Write(checksum)
+	return h.Sum(nil)
+}
+
+// entryIntegrity records and verifies the integrity of a stream of Entries.
+type entryIntegrity struct {
+	enabled bool
+	chain   []byte
+}
+
+// seal sets the integrity fields of e, which must be final otherwise.
+func (ei *entryIntegrity) seal(e *Entry) error {
+	sum, err := entryChecksum(*e)
+	if err != nil {
+		return err
+	}
+	ei.chain = nextChain(ei.chain, sum)
+	e.Checksum, e.Chain = sum, ei.chain
+	return nil
+}
+
+// verify checks the integrity fields of e, the Entry at position. Once an
+// Entry had them, all following Entries must have them.
+func (ei *entryIntegrity) verify(e *Entry, position int) error {
+	if len(e.Checksum) == 0 && len(e.Chain) == 0 {
+		if ei.enabled {
+			return &CorruptEntryError{Position: position, Reason: "missing checksum"}
+		}
+		return nil
+	}
+	ei.enabled = true
+	sum, err := entryChecksum(*e)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sum, e.Checksum) {
+		return &CorruptEntryError{Position: position, Reason: "checksum mismatch"}
+	}
+	ei.chain = nextChain(ei.chain, sum)
+	if !bytes.Equal(ei.chain, e.Chain) {
+		return &CorruptEntryError{Position: position, Reason: "chain mismatch, entries are missing or out of order"}
+	}
+	return nil
+}
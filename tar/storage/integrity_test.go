@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func packWithChecksums(t *testing.T) []string {
+	e := []Entry{
+		{Type: SegmentType, Payload: []byte("how")},
+		{Type: SegmentType, Payload: []byte("y'all")},
+		{Type: FileType, Name: "./hurr.txt", Payload: []byte("deadbeef")},
+		{Type: SegmentType, Payload: []byte("doin")},
+	}
+	buf := bytes.NewBuffer(nil)
+	jp := NewJSONPackerWithChecksums(buf)
+	for i := range e {
+		if _, err := jp.AddEntry(e[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func unpackLines(lines []string) (int, error) {
+	jup := NewJSONUnpacker(strings.NewReader(strings.Join(lines, "")))
+	var n int
+	for {
+		_, err := jup.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		n++
+	}
+}
+
+func TestEntryChecksums(t *testing.T) {
+	lines := packWithChecksums(t)
+	if n, err := unpackLines(lines); err != nil || n != 4 {
+		t.Fatalf("expected 4 valid entries, got %d: %v", n, err)
+	}
+
+	// "how" is "aG93" in base64, "hoe" is "aG9l"
+	corrupt := append([]string{}, lines...)
+	corrupt[0] = strings.Replace(corrupt[0], `"aG93"`, `"aG9l"`, 1)
+	missing := append(append([]string{}, lines[:1]...), lines[2:]...)
+	unsealed := append([]string{}, lines...)
+	unsealed[3] = `{"type":2,"payload":"ZG9pbg==","position":3}` + "\n"
+
+	for _, tc := range []struct {
+		lines    []string
+		position int
+		reason   string
+	}{
+		{corrupt, 0, "checksum mismatch"},
+		{missing, 1, "chain mismatch"},
+		{unsealed, 3, "missing checksum"},
+	} {
+		_, err := unpackLines(tc.lines)
+		var cee *CorruptEntryError
+		if !errors.As(err, &cee) {
+			t.Errorf("expected a CorruptEntryError, got %v", err)
+			continue
+		}
+		if cee.Position != tc.position || !strings.Contains(cee.Reason, tc.reason) {
+			t.Errorf("expected %q at position %d, got %v", tc.reason, tc.position, cee)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AUFS-style whiteouts, as used in tar archives of container image layers to
+// record deletions.
+const (
+	// WhiteoutPrefix prefixes the base name of a file or directory that was
+	// deleted.
+	WhiteoutPrefix = ".wh."
+	// WhiteoutMetaPrefix prefixes the base name of whiteout metadata files,
+	// rather than of deleted files.
+	WhiteoutMetaPrefix = WhiteoutPrefix + WhiteoutPrefix
+	// WhiteoutOpaqueDir is the base name marking its directory as opaque, so
+	// none of the directory's prior content is visible.
+	WhiteoutOpaqueDir = WhiteoutMetaPrefix + ".opq"
+)
+
+// ParseWhiteout reports whether name is an AUFS-style whiteout. If so, target
+// is the name of the deleted file, or of the directory that is opaque.
+func ParseWhiteout(name string) (target string, opaque bool, ok bool) {
+	dir, base := path.Split(name)
+	switch {
+	case base == WhiteoutOpaqueDir:
+		return path.Clean(dir), true, true
+	case strings.HasPrefix(base, WhiteoutMetaPrefix):
+		return "", false, false
+	case strings.HasPrefix(base, WhiteoutPrefix):
+		return path.Join(dir, base[len(WhiteoutPrefix):]), false, true
+	}
+	return "", false, false
+}
+
+// NewOverlayFileGetter returns a FileGetter for files relative to the
+// overlayfs upper directory upperdir, translating between the AUFS-style
+// whiteouts of tar archives and the overlayfs whiteouts on disk.
+//
+// Getting a whiteout name, like "dir/.wh.file", succeeds with an empty payload
+// only if the overlayfs whiteout for "dir/file" exists on disk, i.e. a
+// character device 0/0 or a file with the overlay whiteout xattr. Likewise,
+// "dir/.wh..wh..opq" requires "dir" to be marked opaque with the overlay
+// opaque xattr. Getting a file which is an overlayfs whiteout on disk fails as
+// if it did not exist.
+//
+// Overlayfs whiteouts are only detected on Linux.
+func NewOverlayFileGetter(upperdir string) FileGetter {
+	return &overlayFileGetter{root: upperdir}
+}
+
+type overlayFileGetter struct {
+	root string
+}
+
+// IsOverlayWhiteout reports whether the file at path p is an overlayfs
+// whiteout, i.e. a character device 0/0 or a file with the overlay whiteout
+// xattr. It is false for a file that does not exist, and always on other
+// systems than Linux.
+func IsOverlayWhiteout(p string) (bool, error) {
+	return isOverlayWhiteout(p)
+}
+
+// IsOverlayOpaque reports whether the directory at path p is marked opaque
+// with the overlay opaque xattr. It is false for a file that does not exist,
+// and always on other systems than Linux.
+func IsOverlayOpaque(p string) (bool, error) {
+	return isOverlayOpaque(p)
+}
+
+func (ofg overlayFileGetter) Get(filename string) (io.ReadCloser, error) {
+	if target, opaque, ok := ParseWhiteout(filename); ok {
+		p := filepath.Join(ofg.root, target)
+		var found bool
+		var err error
+		if opaque {
+			found, err = isOverlayOpaque(p)
+		} else {
+			found, err = isOverlayWhiteout(p)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("no overlay whiteout on disk for %q", filename)
+		}
+		return &readCloserWrapper{bytes.NewReader(nil)}, nil
+	}
+
+	p := filepath.Join(ofg.root, filename)
+	wh, err := isOverlayWhiteout(p)
+	if err != nil {
+		return nil, err
+	}
+	if wh {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	return os.Open(p)
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	// overlayfs uses the trusted namespace, or the user namespace when
+	// mounted with the userxattr option.
+	overlayOpaqueXattrs   = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+	overlayWhiteoutXattrs = []string{"trusted.overlay.whiteout", "user.overlay.whiteout"}
+)
+
+// isOverlayWhiteout reports whether p is an overlayfs whiteout.
+func isOverlayWhiteout(p string) (bool, error) {
+	fi, err := os.Lstat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	switch {
+	case fi.Mode()&os.ModeCharDevice != 0:
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		return ok && st.Rdev == 0, nil
+	case fi.Mode().IsRegular() && fi.Size() == 0:
+		return hasXattr(p, overlayWhiteoutXattrs, ""), nil
+	}
+	return false, nil
+}
+
+// isOverlayOpaque reports whether p is a directory marked as opaque.
+func isOverlayOpaque(p string) (bool, error) {
+	fi, err := os.Lstat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return fi.IsDir() && hasXattr(p, overlayOpaqueXattrs, "y"), nil
+}
+
+// hasXattr reports whether p has any of the xattrs, with the value if not
+// empty. Errors, like missing privileges for the trusted namespace, are
+// treated as the xattr not being present.
+func hasXattr(p string, xattrs []string, value string) bool {
+	buf := make([]byte, 16)
+	for _, x := range xattrs {
+		n, err := syscall.Getxattr(p, x, buf)
+		if err == syscall.ERANGE && value == "" {
+			return true // present, with a longer value
+		}
+		if err != nil {
+			continue
+		}
+		if value == "" || string(buf[:n]) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package storage
+
+func isOverlayWhiteout(p string) (bool, error) { return false, nil }
+
+func isOverlayOpaque(p string) (bool, error) { return false, nil }
@@ -0,0 +1,24 @@
+package storage
+
+import "testing"
+
+func TestParseWhiteout(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target string
+		opaque bool
+		ok     bool
+	}{
+		{"etc/hosts", "", false, false},
+		{"etc/.wh.hosts", "etc/hosts", false, true},
+		{"./.wh.etc", "etc", false, true},
+		{"etc/.wh..wh..opq", "etc", true, true},
+		{".wh..wh..opq", ".", true, true},
+		{"etc/.wh..wh.plnk", "", false, false},
+	} {
+		target, opaque, ok := ParseWhiteout(tc.name)
+		if target != tc.target || opaque != tc.opaque || ok != tc.ok {
+			t.Errorf("%q: expected (%q, %v, %v); got (%q, %v, %v)", tc.name, tc.target, tc.opaque, tc.ok, target, opaque, ok)
+		}
+	}
+}
@@ -24,9 +24,15 @@ type Unpacker interface {
 	Next() (*Entry, error)
 }
 
+// ErrMisplacedPreamble occurs when a PreambleType entry is not the first
+// entry of a metadata stream
+var ErrMisplacedPreamble = errors.New("tar-split preamble is not the first entry")
+
 type jsonUnpacker struct {
-	seen seenNames
-	dec  *json.Decoder
+	seen      seenNames
+	dec       *json.Decoder
+	count     int
+	integrity entryIntegrity
 }
 
 func (jup *jsonUnpacker) Next() (*Entry, error) {
@@ -35,9 +41,31 @@ func (jup *jsonUnpacker) Next() (*Entry, error) {
 	if err != nil {
 		return nil, err
 	}
+	jup.count++
+	if err := jup.integrity.verify(&e, jup.count-1); err != nil {
+		return nil, err
+	}
+	if err := CheckType(&e); err != nil {
+		return nil, err
+	}
+	if e.Type == ZeroSegmentType {
+		if err := expandZeroRun(&e, jup.count-1); err != nil {
+			return nil, err
+		}
+	}
+
+	// validate the preamble, streams without one are version 0
+	if e.Type == PreambleType {
+		if jup.count != 1 {
+			return nil, ErrMisplacedPreamble
+		}
+		if _, err := DecodePreamble(&e); err != nil {
+			return nil, err
+		}
+	}
 
 	// check for dup name
-	if e.Type == FileType {
+	if e.Type == FileType && jup.seen != nil {
 		cName := filepath.Clean(e.GetName())
 		if _, ok := jup.seen[cName]; ok {
 			return nil, ErrDuplicatePath
@@ -52,6 +80,16 @@ func (jup *jsonUnpacker) Next() (*Entry, error) {
 // FileType) as a json document.
 //
 // Each Entry read are expected to be delimited by new line.
+//
+// A PreambleType entry is validated, and an *UnsupportedVersionError returned
+// if the stream has a later format version than supported. Entries of
+// unknown critical Types are rejected with an *UnknownTypeError, see
+// CheckType.
+//
+// If the Entries have checksums, they are verified, and a *CorruptEntryError
+// returned for the first Entry failing verification.
+//
+// ZeroSegmentType entries are expanded to the equivalent SegmentType entries.
 func NewJSONUnpacker(r io.Reader) Unpacker {
 	return &jsonUnpacker{
 		dec:  json.NewDecoder(r),
@@ -59,11 +97,40 @@ func NewJSONUnpacker(r io.Reader) Unpacker {
 	}
 }
 
+// NewJSONUnpackerWithDuplicates provides an Unpacker like NewJSONUnpacker,
+// but which returns the FileType entries of the paths already seen rather
+// than ErrDuplicatePath, for consumers keeping track of the paths themselves.
+func NewJSONUnpackerWithDuplicates(r io.Reader) Unpacker {
+	return &jsonUnpacker{
+		dec: json.NewDecoder(r),
+	}
+}
+
+// NewEntriesUnpacker provides an Unpacker for Entries in memory, returning
+// copies of them as they are, without validation.
+func NewEntriesUnpacker(entries []Entry) Unpacker {
+	return &entriesUnpacker{entries: entries}
+}
+
+type entriesUnpacker struct {
+	entries []Entry
+}
+
+func (eu *entriesUnpacker) Next() (*Entry, error) {
+	if len(eu.entries) == 0 {
+		return nil, io.EOF
+	}
+	e := eu.entries[0]
+	eu.entries = eu.entries[1:]
+	return &e, nil
+}
+
 type jsonPacker struct {
-	w    io.Writer
-	e    *json.Encoder
-	pos  int
-	seen seenNames
+	w         io.Writer
+	e         *json.Encoder
+	pos       int
+	seen      seenNames
+	integrity *entryIntegrity
 }
 
 type seenNames map[string]struct{}
@@ -87,6 +154,12 @@ func (jp *jsonPacker) AddEntry(e Entry) (int, error) {
 	}
 
 	e.Position = jp.pos
+	e.Checksum, e.Chain = nil, nil
+	if jp.integrity != nil {
+		if err := jp.integrity.seal(&e); err != nil {
+			return -1, err
+		}
+	}
 	err := jp.e.Encode(e)
 	if err != nil {
 		return -1, err
@@ -108,3 +181,15 @@ func NewJSONPacker(w io.Writer) Packer {
 		seen: seenNames{},
 	}
 }
+
+// NewJSONPackerWithChecksums provides a Packer like NewJSONPacker, that also
+// records the checksum of each Entry, and a hash chaining it to all previous
+// Entries, for the Unpacker to detect corrupt, missing or reordered Entries.
+func NewJSONPackerWithChecksums(w io.Writer) Packer {
+	return &jsonPacker{
+		w:         w,
+		e:         json.NewEncoder(w),
+		seen:      seenNames{},
+		integrity: &entryIntegrity{},
+	}
+}
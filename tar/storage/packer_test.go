@@ -3,6 +3,7 @@ package storage
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/json"
 	"io"
 	"os"
 	"testing"
@@ -41,6 +42,35 @@ func TestDuplicateFail(t *testing.T) {
 	}
 }
 
+func TestDuplicateUnpack(t *testing.T) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i, name := range []string{"./hurr.txt", "hurr.txt"} {
+		if err := enc.Encode(Entry{Type: FileType, Name: name, Position: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jup := NewJSONUnpacker(bytes.NewReader(buf.Bytes()))
+	if _, err := jup.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := jup.Next(); err != ErrDuplicatePath || entry != nil {
+		t.Errorf("expected failure on duplicate path, got %v, %v", entry, err)
+	}
+
+	jup = NewJSONUnpackerWithDuplicates(bytes.NewReader(buf.Bytes()))
+	for i := 0; i < 2; i++ {
+		entry, err := jup.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Position != i {
+			t.Errorf("expected the entry at position %d, got %d", i, entry.Position)
+		}
+	}
+}
+
 func TestJSONPackerUnpacker(t *testing.T) {
 	e := []Entry{
 		{
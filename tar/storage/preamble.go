@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// FormatVersion is the version of the metadata stream format. It is recorded
+// in the Preamble, and streams with a later version are rejected.
+//
+// Streams without a Preamble predate versioning, and are version 0.
+const FormatVersion = 1
+
+// DefaultProducer identifies this library as the producer of metadata
+// streams, in their Preamble, unless the program using it sets its own.
+const DefaultProducer = "github.com/vbatts/tar-split"
+
+// Preamble describes a metadata stream, and how it was produced.
+type Preamble struct {
+	// Version of the format of the stream
+	Version int `json:"version"`
+	// Producer of the stream, and its version
+	Producer string `json:"producer,omitempty"`
+	// DigestAlgorithm of the TrailerType entry following the stream, if
+	// there is one, so consumers can digest the stream from the start
+	DigestAlgorithm string `json:"digest_algorithm,omitempty"`
+	// Options used for disassembling the archive
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// NewPreamble returns the Preamble for a new metadata stream, produced by
+// this library.
+func NewPreamble() Preamble {
+	return Preamble{
+		Version:  FormatVersion,
+		Producer: DefaultProducer,
+	}
+}
+
+// PackerOptions returns the options of the Packers of this package that p
+// packs with, like "checksums" and "zero_runs", as recorded in the Options of
+// a Preamble.
+func PackerOptions(p Packer) map[string]string {
+	opts := map[string]string{}
+	for {
+		switch pp := p.(type) {
+		case *zeroRunPacker:
+			opts["zero_runs"] = "true"
+			p = pp.p
+			continue
+		case *SigningPacker:
+			p = pp.p
+			continue
+		case *jsonPacker:
+			if pp.integrity != nil {
+				opts["checksums"] = "true"
+			}
+		}
+		return opts
+	}
+}
+
+// packerOptions are the Options of a Preamble that PackerOptions sets.
+var packerOptions = []string{"checksums", "zero_runs"}
+
+// Repacked returns a copy of the Preamble for the stream repacked to p, with
+// the Options of the Packer it was packed with replaced by those of p, see
+// PackerOptions. The other Options, of how the archive was disassembled, are
+// kept.
+func (p Preamble) Repacked(pk Packer) Preamble {
+	opts := PackerOptions(pk)
+	for k, v := range p.Options {
+		if !containsString(packerOptions, k) {
+			opts[k] = v
+		}
+	}
+	if len(opts) == 0 {
+		opts = nil
+	}
+	p.Options = opts
+	return p
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Entry returns the PreambleType entry for the Preamble.
+func (p Preamble) Entry() (Entry, error) {
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{
+		Type:    PreambleType,
+		Payload: buf,
+	}, nil
+}
+
+// UnsupportedVersionError is returned for metadata streams with a later
+// format version than FormatVersion.
+type UnsupportedVersionError struct {
+	Version  int
+	Producer string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported tar-split metadata version %d (produced by %q), only up to %d is supported", e.Version, e.Producer, FormatVersion)
+}
+
+// DecodePreamble decodes and validates the Preamble of a PreambleType entry.
+func DecodePreamble(e *Entry) (*Preamble, error) {
+	if e.Type != PreambleType {
+		return nil, fmt.Errorf("not a tar-split preamble entry: type %d", e.Type)
+	}
+	var p Preamble
+	if err := json.Unmarshal(e.Payload, &p); err != nil {
+		return nil, fmt.Errorf("decoding tar-split preamble: %w", err)
+	}
+	if p.Version > FormatVersion {
+		return nil, &UnsupportedVersionError{Version: p.Version, Producer: p.Producer}
+	}
+	return &p, nil
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestPreamble(t *testing.T) {
+	pre := NewPreamble()
+	pre.Producer = "tar-split test"
+	pre.DigestAlgorithm = DigestAlgorithm
+	pre.Options = map[string]string{"foo": "bar"}
+	e, err := pre.Entry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	jp := NewJSONPacker(buf)
+	for _, entry := range []Entry{e, {Type: SegmentType, Payload: []byte("how")}} {
+		if _, err := jp.AddEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jup := NewJSONUnpacker(buf)
+	entry, err := jup.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodePreamble(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != FormatVersion || got.Producer != "tar-split test" || got.DigestAlgorithm != DigestAlgorithm || got.Options["foo"] != "bar" {
+		t.Errorf("unexpected preamble %#v", got)
+	}
+	if _, err := jup.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jup.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestPackerOptions(t *testing.T) {
+	for _, tc := range []struct {
+		p    Packer
+		opts map[string]string
+	}{
+		{NewJSONPacker(io.Discard), map[string]string{}},
+		{NewJSONPackerWithChecksums(io.Discard), map[string]string{"checksums": "true"}},
+		{NewZeroRunPacker(NewJSONPacker(io.Discard)), map[string]string{"zero_runs": "true"}},
+		{NewSigningPacker(NewZeroRunPacker(NewJSONPackerWithChecksums(io.Discard)), nil), map[string]string{"checksums": "true", "zero_runs": "true"}},
+	} {
+		if opts := PackerOptions(tc.p); !reflect.DeepEqual(opts, tc.opts) {
+			t.Errorf("%T: options %v, expected %v", tc.p, opts, tc.opts)
+		}
+	}
+}
+
+func TestPreambleRepacked(t *testing.T) {
+	pre := NewPreamble()
+	pre.Options = map[string]string{"checksums": "true", "zero_runs": "true", "segment_kinds": "true"}
+
+	repacked := pre.Repacked(NewJSONPacker(io.Discard))
+	if expected := map[string]string{"segment_kinds": "true"}; !reflect.DeepEqual(repacked.Options, expected) {
+		t.Errorf("options %v, expected %v", repacked.Options, expected)
+	}
+	if pre.Options["checksums"] != "true" {
+		t.Errorf("expected the preamble to be left alone, got options %v", pre.Options)
+	}
+	pre.Options = map[string]string{"zero_runs": "true"}
+	if repacked := pre.Repacked(NewJSONPackerWithChecksums(io.Discard)); !reflect.DeepEqual(repacked.Options, map[string]string{"checksums": "true"}) {
+		t.Errorf("options %v, expected only checksums", repacked.Options)
+	}
+	pre.Options = nil
+	if repacked := pre.Repacked(NewJSONPacker(io.Discard)); repacked.Options != nil {
+		t.Errorf("expected no options, got %v", repacked.Options)
+	}
+}
+
+func TestPreambleUnsupported(t *testing.T) {
+	future := NewPreamble()
+	future.Version = FormatVersion + 1
+	fe, err := future.Entry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := NewPreamble().Entry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		entries []Entry
+		check   func(err error) bool
+	}{
+		{
+			entries: []Entry{fe},
+			check: func(err error) bool {
+				var uve *UnsupportedVersionError
+				return errors.As(err, &uve) && uve.Version == FormatVersion+1
+			},
+		},
+		{
+			entries: []Entry{{Type: SegmentType, Payload: []byte("how")}, current},
+			check:   func(err error) bool { return err == ErrMisplacedPreamble },
+		},
+	} {
+		buf := bytes.NewBuffer(nil)
+		jp := NewJSONPacker(buf)
+		for _, e := range tc.entries {
+			if _, err := jp.AddEntry(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		jup := NewJSONUnpacker(buf)
+		var err error
+		for err == nil {
+			_, err = jup.Next()
+		}
+		if !tc.check(err) {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// SignatureType represents a signature over all the previous Entries of the
+// metadata stream, as its last entry. As verifying it is optional for
+// assembly, it is ignorable.
+//
+// Its Name is the signature algorithm (see SignatureAlgorithm) and its Payload
+// the signature.
+const SignatureType = IgnorableTypeFlag | 1
+
+// SignatureAlgorithm is the signature algorithm of SignatureType entries, and
+// detached signatures.
+const SignatureAlgorithm = "ed25519"
+
+// signaturePrefix separates the signed digests from other uses of the keys.
+const signaturePrefix = "tar-split metadata signature v1\n"
+
+var (
+	// ErrUnsigned occurs when verifying metadata without a signature
+	ErrUnsigned = errors.New("tar-split metadata is not signed")
+	// ErrBadSignature occurs when the signature of the metadata does not
+	// verify
+	ErrBadSignature = errors.New("tar-split metadata signature verification failed")
+)
+
+// EntryDigester computes the digest of a stream of Entries that signatures are
+// made over. Only the content of the Entries is digested, not their Position
+// or integrity fields, so it does not depend on the Packer.
+type EntryDigester struct {
+	h hash.Hash
+}
+
+// NewEntryDigester returns a new EntryDigester.
+func NewEntryDigester() *EntryDigester {
+	return &EntryDigester{h: sha256.New()}
+}
+
+// Add adds e to the digest. SignatureType entries are not digested, and
+// ZeroSegmentType entries are digested as the SegmentType they expand to.
+func (ed *EntryDigester) Add(e *Entry) error {
+	if e.Type == SignatureType {
+		return nil
+	}
+	if e.Type == ZeroSegmentType {
+		x := *e
+		if err := expandZeroRun(&x, e.Position); err != nil {
+			return err
+		}
+		e = &x
+	}
+	c := Entry{
+		Type:    e.Type,
+		Size:    e.Size,
+		Payload: e.Payload,
+		Kind:    e.Kind,
+	}
+	c.SetNameBytes(e.GetNameBytes())
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = ed.h.Write(append(buf, '\n'))
+	return err
+}
+
+// Sum returns the digest of the Entries added so far.
+func (ed *EntryDigester) Sum() []byte {
+	return ed.h.Sum(nil)
+}
+
+func signatureMessage(digest []byte) []byte {
+	return append([]byte(signaturePrefix), digest...)
+}
+
+// SigningPacker is a Packer that digests the Entries it packs, to sign them
+// with Sign.
+type SigningPacker struct {
+	p   Packer
+	key ed25519.PrivateKey
+	d   *EntryDigester
+}
+
+// NewSigningPacker returns a SigningPacker packing the Entries to p, and
+// signing them with key.
+func NewSigningPacker(p Packer, key ed25519.PrivateKey) *SigningPacker {
+	return &SigningPacker{p: p, key: key, d: NewEntryDigester()}
+}
+
+// AddEntry packs the Entry and returns its position
+func (sp *SigningPacker) AddEntry(e Entry) (int, error) {
+	if e.Type == SignatureType {
+		return -1, errors.New("tar-split signature entries are added with Sign")
+	}
+	if err := sp.d.Add(&e); err != nil {
+		return -1, err
+	}
+	return sp.p.AddEntry(e)
+}
+
+// Sign packs a SignatureType entry, signing all the Entries packed so far. No
+// Entries may be packed after it.
+func (sp *SigningPacker) Sign() (int, error) {
+	return sp.p.AddEntry(Entry{
+		Type:    SignatureType,
+		Name:    SignatureAlgorithm,
+		Payload: ed25519.Sign(sp.key, signatureMessage(sp.d.Sum())),
+	})
+}
+
+// SignDetached reads all the Entries from up, and returns a detached
+// signature over them with key. Any signature entries are ignored.
+func SignDetached(up Unpacker, key ed25519.PrivateKey) ([]byte, error) {
+	d := NewEntryDigester()
+	for {
+		e, err := up.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if err := d.Add(e); err != nil {
+			return nil, err
+		}
+	}
+	return ed25519.Sign(key, signatureMessage(d.Sum())), nil
+}
+
+// VerifySignature reads all the Entries from up, and verifies they are signed
+// by the key pub, with the detached signature if it is not nil, or else with
+// the SignatureType entry that must be the last Entry. It returns
+// ErrUnsigned if there is no signature, and ErrBadSignature if it does not
+// verify.
+//
+// As nothing from the metadata can be trusted before verification, the
+// Entries are buffered, and the returned Unpacker replays them once verified.
+func VerifySignature(up Unpacker, pub ed25519.PublicKey, detached []byte) (Unpacker, error) {
+	d := NewEntryDigester()
+	var entries []Entry
+	var embedded *Entry
+	for {
+		e, err := up.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if embedded != nil {
+			return nil, fmt.Errorf("%w: entries follow the signature", ErrBadSignature)
+		}
+		if e.Type == SignatureType {
+			embedded = e
+		} else if err := d.Add(e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+
+	sig := detached
+	if sig == nil {
+		if embedded == nil {
+			return nil, ErrUnsigned
+		}
+		if embedded.Name != SignatureAlgorithm {
+			return nil, fmt.Errorf("%w: unsupported signature algorithm %q", ErrBadSignature, embedded.Name)
+		}
+		sig = embedded.Payload
+	}
+	if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, signatureMessage(d.Sum()), sig) {
+		return nil, ErrBadSignature
+	}
+	return NewEntriesUnpacker(entries), nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+var signatureEntries = []Entry{
+	{Type: SegmentType, Payload: []byte("how")},
+	{Type: FileType, Name: "./hurr.txt", Size: 8, Payload: []byte("deadbeef")},
+	{Type: SegmentType, Payload: []byte("doin")},
+}
+
+func packSigned(t *testing.T, key ed25519.PrivateKey) string {
+	buf := bytes.NewBuffer(nil)
+	sp := NewSigningPacker(NewJSONPacker(buf), key)
+	for _, e := range signatureEntries {
+		if _, err := sp.AddEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := sp.Sign(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func packUnsigned(t *testing.T) string {
+	buf := bytes.NewBuffer(nil)
+	jp := NewJSONPacker(buf)
+	for _, e := range signatureEntries {
+		if _, err := jp.AddEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func countEntries(t *testing.T, up Unpacker) int {
+	var n int
+	for {
+		if _, err := up.Next(); err != nil {
+			if err == io.EOF {
+				return n
+			}
+			t.Fatal(err)
+		}
+		n++
+	}
+}
+
+func TestSignature(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := packSigned(t, key)
+	up, err := VerifySignature(NewJSONUnpacker(strings.NewReader(signed)), pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the signature entry is replayed too
+	if n := countEntries(t, up); n != len(signatureEntries)+1 {
+		t.Errorf("expected %d entries, got %d", len(signatureEntries)+1, n)
+	}
+
+	unsigned := packUnsigned(t)
+	detached, err := SignDetached(NewJSONUnpacker(strings.NewReader(unsigned)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, err = VerifySignature(NewJSONUnpacker(strings.NewReader(unsigned)), pub, detached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countEntries(t, up); n != len(signatureEntries) {
+		t.Errorf("expected %d entries, got %d", len(signatureEntries), n)
+	}
+	// signature entries are not part of what is signed
+	if _, err := VerifySignature(NewJSONUnpacker(strings.NewReader(signed)), pub, detached); err != nil {
+		t.Errorf("expected the detached signature to verify the signed metadata: %v", err)
+	}
+
+	if _, err := VerifySignature(NewJSONUnpacker(strings.NewReader(unsigned)), pub, nil); err != ErrUnsigned {
+		t.Errorf("expected %v, got %v", ErrUnsigned, err)
+	}
+
+	// "deadbeef" is "ZGVhZGJlZWY=" in base64, "deadbeee" is "ZGVhZGJlZWU="
+	tampered := strings.Replace(signed, `"ZGVhZGJlZWY="`, `"ZGVhZGJlZWU="`, 1)
+	lines := strings.SplitAfter(signed, "\n")
+	trailing := signed + lines[len(lines)-3]
+	for _, tc := range []struct {
+		name     string
+		metadata string
+		pub      ed25519.PublicKey
+	}{
+		{"tampered", tampered, pub},
+		{"wrong key", signed, otherPub},
+		{"entries after signature", trailing, pub},
+	} {
+		_, err := VerifySignature(NewJSONUnpacker(strings.NewReader(tc.metadata)), tc.pub, nil)
+		if !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: expected %v, got %v", tc.name, ErrBadSignature, err)
+		}
+	}
+}
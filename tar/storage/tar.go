@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/vbatts/tar-split/archive/tar"
+)
+
+// NewTarFileGetter returns a FileGetter serving the payloads of the regular
+// files in the tar archive r, by name. This allows reassembling an archive
+// from another archive with the same files, like a re-exported or
+// recompressed variant of it.
+//
+// Names are compared after cleaning, so "./etc/hosts", "/etc/hosts" and
+// "etc/hosts" are the same file.
+//
+// If r is an io.ReaderAt, the archive is indexed up front, and payloads are
+// read directly at their offsets in any order. Hardlinks in r are resolved to
+// their target. Otherwise, the archive is read as a stream, so the payloads
+// must be requested in the order they appear in r, and each must be read
+// before requesting the next. The payload of a hardlink has been read past by
+// then, so getting it is an error.
+func NewTarFileGetter(r io.Reader) (FileGetter, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		return newIndexedTarFileGetter(ra)
+	}
+	return &streamTarFileGetter{tr: tar.NewReader(r)}, nil
+}
+
+// cleanTarName normalizes the name of a tar entry, for comparison.
+func cleanTarName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func isTarPayload(hdr *tar.Header) bool {
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeCont, tar.TypeGNUSparse:
+		return true
+	}
+	return false
+}
+
+// IsSparse reports whether hdr is of a sparse file, in the old GNU format or
+// in any of the PAX ones, whose payload is not the content of the file.
+func IsSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+type tarPayload struct {
+	index  int   // ordinal of the entry in the archive
+	offset int64 // offset of the data, unless sparse
+	size   int64
+	sparse bool // the data is not stored contiguously, read it through a tar.Reader
+}
+
+type indexedTarFileGetter struct {
+	ra    io.ReaderAt
+	files map[string]tarPayload
+}
+
+func newIndexedTarFileGetter(ra io.ReaderAt) (*indexedTarFileGetter, error) {
+	itfg := &indexedTarFileGetter{
+		ra:    ra,
+		files: map[string]tarPayload{},
+	}
+	sr := io.NewSectionReader(ra, 0, math.MaxInt64)
+	tr := tar.NewReader(sr)
+	links := map[string]string{}
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		name := cleanTarName(hdr.Name)
+		switch {
+		case hdr.Typeflag == tar.TypeLink:
+			links[name] = cleanTarName(hdr.Linkname)
+		case isTarPayload(hdr):
+			// the reader is positioned at the start of the data
+			offset, err := sr.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			delete(links, name)
+			itfg.files[name] = tarPayload{
+				index:  i,
+				offset: offset,
+				size:   hdr.Size,
+				sparse: IsSparse(hdr),
+			}
+		}
+	}
+	for name, target := range links {
+		if p, ok := itfg.files[target]; ok {
+			itfg.files[name] = p
+		}
+	}
+	return itfg, nil
+}
+
+func (itfg *indexedTarFileGetter) Get(name string) (io.ReadCloser, error) {
+	p, ok := itfg.files[cleanTarName(name)]
+	if !ok {
+		return nil, fmt.Errorf("no such file %q in tar archive", name)
+	}
+	if !p.sparse {
+		return &readCloserWrapper{io.NewSectionReader(itfg.ra, p.offset, p.size)}, nil
+	}
+	// sparse files have to be expanded by a tar.Reader, from the start
+	tr := tar.NewReader(io.NewSectionReader(itfg.ra, 0, math.MaxInt64))
+	for i := 0; i <= p.index; i++ {
+		if _, err := tr.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return &readCloserWrapper{tr}, nil
+}
+
+type streamTarFileGetter struct {
+	mu sync.Mutex
+	tr *tar.Reader
+}
+
+func (stfg *streamTarFileGetter) Get(name string) (io.ReadCloser, error) {
+	stfg.mu.Lock()
+	defer stfg.mu.Unlock()
+	want := cleanTarName(name)
+	for {
+		hdr, err := stfg.tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("no such file %q in the rest of the tar archive", name)
+			}
+			return nil, err
+		}
+		if cleanTarName(hdr.Name) != want {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			return nil, fmt.Errorf("%q is a hardlink to %q, which a tar archive read as a stream cannot resolve", name, hdr.Linkname)
+		}
+		if isTarPayload(hdr) {
+			return &readCloserWrapper{stfg.tr}, nil
+		}
+	}
+}
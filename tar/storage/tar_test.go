@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vbatts/tar-split/archive/tar"
+)
+
+func TestTarFileGetter(t *testing.T) {
+	for _, path := range []string{
+		"../../archive/tar/testdata/gnu.tar",
+		"../../archive/tar/testdata/pax.tar",
+		"../../archive/tar/testdata/sparse-formats.tar",
+		"../../archive/tar/testdata/hardlink.tar",
+	} {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the expected payloads, in order
+		var names []string
+		payloads := map[string][]byte{}
+		tr := tar.NewReader(bytes.NewReader(buf))
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				t.Fatal(err)
+			}
+			if !isTarPayload(hdr) {
+				continue
+			}
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, hdr.Name)
+			payloads[hdr.Name] = b
+		}
+
+		indexed, err := NewTarFileGetter(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream, err := NewTarFileGetter(struct{ io.Reader }{bytes.NewReader(buf)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the indexed getter can go in any order
+		for i := len(names) - 1; i >= 0; i-- {
+			checkTarPayload(t, indexed, "./"+names[i], payloads[names[i]])
+		}
+		for _, name := range names {
+			checkTarPayload(t, stream, name, payloads[name])
+		}
+		if len(names) > 0 {
+			if _, err := stream.Get(names[0]); err == nil {
+				t.Errorf("%s: expected the stream getter to fail going backwards", path)
+			}
+		}
+	}
+}
+
+func TestTarFileGetterHardlink(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "file", Size: 3, Mode: 0o644}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "file"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fg, err := NewTarFileGetter(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTarPayload(t, fg, "link", []byte("foo"))
+
+	// not when streamed, as the payload is read past
+	fg, err = NewTarFileGetter(struct{ io.Reader }{bytes.NewReader(buf.Bytes())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fg.Get("link"); err == nil || !strings.Contains(err.Error(), "hardlink") {
+		t.Errorf("expected an error getting a hardlink from a stream; got %v", err)
+	}
+}
+
+func checkTarPayload(t *testing.T, fg FileGetter, name string, expected []byte) {
+	t.Helper()
+	rc, err := fg.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("%q: expected %d bytes; got %d", name, len(expected), len(got))
+	}
+}
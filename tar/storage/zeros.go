@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	// minZeroRun is the smallest run of zero bytes worth storing as a
+	// ZeroSegmentType, below which the base64 encoding is as short.
+	minZeroRun = 32
+	// maxZeroRun bounds what an Unpacker allocates to expand a
+	// ZeroSegmentType. It matches the chunks that NewInputTarStream collects
+	// the padding at the end of an archive in.
+	maxZeroRun = 1024 * 1024
+)
+
+// NewZeroRunPacker returns a Packer packing the Entries to p, with the
+// SegmentType entries only made of zero bytes, like the padding at the end of
+// the archive, packed as ZeroSegmentType entries recording their length
+// instead. The JSON Unpacker expands them back, as does NewZeroRunUnpacker for
+// other Unpackers.
+//
+// Only whole segments are packed so, to get the padding of the files packed
+// too, the archive is disassembled with each kind of segment apart, which
+// asm.NewInputTarStreamWithOptions does for the Packers returned.
+//
+// As ZeroSegmentType is a critical Type, the streams cannot be read by
+// versions of this library predating it.
+func NewZeroRunPacker(p Packer) Packer {
+	return &zeroRunPacker{p: p}
+}
+
+type zeroRunPacker struct {
+	p Packer
+}
+
+func (zp *zeroRunPacker) AddEntry(e Entry) (int, error) {
+	if e.Type == SegmentType && isZeroRun(e.Payload) {
+		e = Entry{
+			Type: ZeroSegmentType,
+			Size: int64(len(e.Payload)),
+			Kind: e.Kind,
+		}
+	}
+	return zp.p.AddEntry(e)
+}
+
+// NewZeroRunUnpacker returns an Unpacker reading the Entries from up, with the
+// ZeroSegmentType entries expanded to the equivalent SegmentType entries, for
+// the consumers only knowing of SegmentType. The Entries are otherwise
+// returned as they are, with the error of up.
+func NewZeroRunUnpacker(up Unpacker) Unpacker {
+	if _, ok := up.(*zeroRunUnpacker); ok {
+		return up
+	}
+	return &zeroRunUnpacker{up: up}
+}
+
+type zeroRunUnpacker struct {
+	up Unpacker
+}
+
+func (zu *zeroRunUnpacker) Next() (*Entry, error) {
+	e, err := zu.up.Next()
+	if e == nil || e.Type != ZeroSegmentType {
+		return e, err
+	}
+	expanded := *e
+	if xerr := expandZeroRun(&expanded, e.Position); xerr != nil {
+		return nil, xerr
+	}
+	return &expanded, err
+}
+
+func isZeroRun(b []byte) bool {
+	if len(b) < minZeroRun || len(b) > maxZeroRun {
+		return false
+	}
+	for len(b) > 0 {
+		n := len(b)
+		if n > len(zeroBlock) {
+			n = len(zeroBlock)
+		}
+		if !bytes.Equal(b[:n], zeroBlock[:n]) {
+			return false
+		}
+		b = b[n:]
+	}
+	return true
+}
+
+var zeroBlock [4096]byte
+
+// expandZeroRun turns a ZeroSegmentType entry at position into the
+// equivalent SegmentType entry.
+func expandZeroRun(e *Entry, position int) error {
+	if e.Size < 0 || e.Size > maxZeroRun || len(e.Payload) != 0 {
+		return &CorruptEntryError{
+			Position: position,
+			Reason:   fmt.Sprintf("invalid zero segment of %d bytes", e.Size),
+		}
+	}
+	e.Type = SegmentType
+	e.Payload = make([]byte, e.Size)
+	e.Size = 0
+	return nil
+}
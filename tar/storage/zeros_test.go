@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestZeroRunPacker(t *testing.T) {
+	e := []Entry{
+		{Type: SegmentType, Payload: append([]byte("header"), make([]byte, 506)...)},
+		{Type: FileType, Name: "./hurr.txt", Size: 8, Payload: []byte("deadbeef")},
+		{Type: SegmentType, Payload: make([]byte, 1024)},
+		{Type: SegmentType, Payload: make([]byte, 4)},
+		{Type: SegmentType, Payload: make([]byte, maxZeroRun+1)},
+	}
+
+	plain := bytes.NewBuffer(nil)
+	jp := NewJSONPacker(plain)
+	compact := bytes.NewBuffer(nil)
+	zp := NewZeroRunPacker(NewJSONPackerWithChecksums(compact))
+	for i := range e {
+		if _, err := jp.AddEntry(e[i]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := zp.AddEntry(e[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if compact.Len() >= plain.Len() {
+		t.Errorf("expected the zero runs to be compacted, got %d bytes for %d", compact.Len(), plain.Len())
+	}
+	if n := strings.Count(compact.String(), `"type":3,`); n != 1 {
+		t.Errorf("expected only the 1024 zero bytes to be packed as a zero segment, got %d", n)
+	}
+
+	jup := NewJSONUnpacker(compact)
+	for i := 0; ; i++ {
+		entry, err := jup.Next()
+		if err != nil {
+			if err == io.EOF {
+				if i != len(e) {
+					t.Errorf("expected %d entries, got %d", len(e), i)
+				}
+				break
+			}
+			t.Fatal(err)
+		}
+		if entry.Type != e[i].Type || entry.Size != e[i].Size || !bytes.Equal(entry.Payload, e[i].Payload) {
+			t.Errorf("%d: expected the entry to be unpacked as packed, got a %s of %d bytes", i, entry.Type, len(entry.Payload))
+		}
+	}
+
+	for _, bad := range []string{
+		`{"type":3,"size":-1,"payload":null,"position":0}`,
+		`{"type":3,"size":1099511627776,"payload":null,"position":0}`,
+		`{"type":3,"size":4,"payload":"aG93","position":0}`,
+	} {
+		_, err := NewJSONUnpacker(strings.NewReader(bad)).Next()
+		var cee *CorruptEntryError
+		if !errors.As(err, &cee) {
+			t.Errorf("%s: expected a CorruptEntryError, got %v", bad, err)
+		}
+	}
+}
+
+func TestZeroRunUnpacker(t *testing.T) {
+	packed := []Entry{
+		{Type: SegmentType, Payload: []byte("header")},
+		{Type: ZeroSegmentType, Size: 1024, Position: 1},
+		{Type: ZeroSegmentType, Size: -1, Position: 2},
+	}
+	zu := NewZeroRunUnpacker(NewEntriesUnpacker(packed))
+	entry, err := zu.Next()
+	if err != nil || !reflect.DeepEqual(*entry, packed[0]) {
+		t.Fatalf("expected the segment as it is, got %#v, %v", entry, err)
+	}
+	entry, err = zu.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != SegmentType || entry.Size != 0 || !bytes.Equal(entry.Payload, make([]byte, 1024)) {
+		t.Errorf("expected the zero segment expanded, got a %s of %d bytes", entry.Type, len(entry.Payload))
+	}
+	if packed[1].Type != ZeroSegmentType {
+		t.Errorf("expected the unpacked entry to be left alone, got a %s", packed[1].Type)
+	}
+	_, err = zu.Next()
+	var cee *CorruptEntryError
+	if !errors.As(err, &cee) || cee.Position != 2 {
+		t.Errorf("expected a CorruptEntryError at position 2, got %v", err)
+	}
+	if _, err := zu.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}